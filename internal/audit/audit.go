@@ -0,0 +1,159 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"rpc-load-balancer/internal/config"
+	"sync"
+	"time"
+)
+
+// Record is one line of the audit log.
+type Record struct {
+	Time     time.Time `json:"time"`
+	Event    string    `json:"event"` // "selection" or "request"
+	Endpoint string    `json:"endpoint"`
+
+	// Selection changes
+	Previous    string `json:"previous,omitempty"`
+	BlockNumber int64  `json:"blockNumber,omitempty"`
+	LatencyMs   int64  `json:"latencyMs,omitempty"`
+
+	// Proxied requests
+	Client     string   `json:"client,omitempty"`
+	Methods    []string `json:"methods,omitempty"`
+	Status     int      `json:"status,omitempty"`
+	DurationMs int64    `json:"durationMs,omitempty"`
+}
+
+// Logger appends routing decisions to a dedicated file as JSON lines. Writes
+// go through a buffer that is flushed periodically and on Close, so logging
+// a request does not cost a write syscall.
+//
+// A nil *Logger is valid and discards everything, which is what Open returns
+// when no audit log is configured.
+type Logger struct {
+	mutex    sync.Mutex
+	file     *os.File
+	writer   *bufio.Writer
+	encoder  *json.Encoder
+	requests bool
+	stop     chan struct{}
+	done     chan struct{}
+	closed   sync.Once
+	closeErr error
+}
+
+// Open opens (or creates) the configured audit log for appending and starts
+// its flush loop. It returns nil when cfg.Path is empty.
+func Open(cfg config.AuditLogConfig) (*Logger, error) {
+	if cfg.Path == "" {
+		return nil, nil
+	}
+	file, err := os.OpenFile(cfg.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o640)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log %s: %w", cfg.Path, err)
+	}
+
+	writer := bufio.NewWriter(file)
+	l := &Logger{
+		file:     file,
+		writer:   writer,
+		encoder:  json.NewEncoder(writer),
+		requests: cfg.Events == config.AuditAll,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go l.flushLoop(cfg.FlushInterval)
+	return l, nil
+}
+
+// LogsRequests reports whether individual proxied requests are recorded.
+func (l *Logger) LogsRequests() bool {
+	return l != nil && l.requests
+}
+
+// Selection records a change of the best endpoint.
+func (l *Logger) Selection(previous, endpoint string, blockNumber int64, latency time.Duration) {
+	l.write(Record{
+		Event:       "selection",
+		Endpoint:    endpoint,
+		Previous:    previous,
+		BlockNumber: blockNumber,
+		LatencyMs:   latency.Milliseconds(),
+	})
+}
+
+// Request records the endpoint chosen for a proxied request. It is a no-op
+// unless the log is configured to record all requests.
+func (l *Logger) Request(client string, methods []string, endpoint string, status int, duration time.Duration) {
+	if !l.LogsRequests() {
+		return
+	}
+	l.write(Record{
+		Event:      "request",
+		Endpoint:   endpoint,
+		Client:     client,
+		Methods:    methods,
+		Status:     status,
+		DurationMs: duration.Milliseconds(),
+	})
+}
+
+func (l *Logger) write(rec Record) {
+	if l == nil {
+		return
+	}
+	rec.Time = time.Now().UTC()
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if err := l.encoder.Encode(rec); err != nil {
+		log.Printf("⚠️ Failed to write audit record: %v", err)
+	}
+}
+
+func (l *Logger) flushLoop(interval time.Duration) {
+	defer close(l.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := l.flush(); err != nil {
+				log.Printf("⚠️ Failed to flush audit log: %v", err)
+			}
+		case <-l.stop:
+			return
+		}
+	}
+}
+
+func (l *Logger) flush() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.writer.Flush()
+}
+
+// Close flushes pending records and closes the file. Gateways sharing the
+// logger may each close it; only the first call does.
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.closed.Do(func() {
+		close(l.stop)
+		<-l.done
+
+		if err := l.flush(); err != nil {
+			l.file.Close()
+			l.closeErr = err
+			return
+		}
+		l.closeErr = l.file.Close()
+	})
+	return l.closeErr
+}
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EndpointsEnvVar names the environment variable holding a comma-separated
+// list of endpoint URLs, used when the config file lists no rpcEndpoints.
+const EndpointsEnvVar = "RPC_ENDPOINTS"
+
+// envReference matches a ${NAME} reference to an environment variable.
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces ${NAME} references in every value of the YAML document
+// with the environment variable's value, so secrets such as API keys in
+// endpoint URLs need not be committed. Keys and comments are left alone. A
+// reference to an unset variable is an error rather than being forwarded as
+// a literal.
+func expandEnv(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		if !envReference.MatchString(node.Value) {
+			return nil
+		}
+		var err error
+		node.Value = envReference.ReplaceAllStringFunc(node.Value, func(ref string) string {
+			name := envReference.FindStringSubmatch(ref)[1]
+			value, ok := os.LookupEnv(name)
+			if !ok && err == nil {
+				err = fmt.Errorf("line %d: environment variable %s is not set", node.Line, name)
+			}
+			return value
+		})
+		if node.Style == 0 {
+			node.Tag = "" // Resolve an unquoted value's type from the expansion, e.g. a number
+		}
+		return err
+	}
+	for i, child := range node.Content {
+		if node.Kind == yaml.MappingNode && i%2 == 0 {
+			continue // Key
+		}
+		if err := expandEnv(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// endpointsFromEnv returns the endpoints listed in EndpointsEnvVar, or nil
+// when it is unset or empty.
+func endpointsFromEnv() []EndpointConfig {
+	var endpoints []EndpointConfig
+	for _, url := range strings.Split(os.Getenv(EndpointsEnvVar), ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			endpoints = append(endpoints, EndpointConfig{URL: url})
+		}
+	}
+	return endpoints
+}
@@ -0,0 +1,163 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TagExpr is a parsed tag expression, such as "archive:true AND region:us".
+// Terms are endpoint tags combined with AND, OR and NOT (any case) and
+// parentheses; AND binds tighter than OR.
+type TagExpr interface {
+	// Match reports whether an endpoint with the given tags satisfies the
+	// expression.
+	Match(tags map[string]bool) bool
+	String() string
+}
+
+type tagTerm string
+
+func (t tagTerm) Match(tags map[string]bool) bool { return tags[string(t)] }
+func (t tagTerm) String() string                  { return string(t) }
+
+type tagNot struct{ expr TagExpr }
+
+func (n tagNot) Match(tags map[string]bool) bool { return !n.expr.Match(tags) }
+func (n tagNot) String() string                  { return "NOT " + n.expr.String() }
+
+type tagAnd []TagExpr
+
+func (a tagAnd) Match(tags map[string]bool) bool {
+	for _, expr := range a {
+		if !expr.Match(tags) {
+			return false
+		}
+	}
+	return true
+}
+
+func (a tagAnd) String() string { return joinTagExprs(a, " AND ") }
+
+type tagOr []TagExpr
+
+func (o tagOr) Match(tags map[string]bool) bool {
+	for _, expr := range o {
+		if expr.Match(tags) {
+			return true
+		}
+	}
+	return false
+}
+
+func (o tagOr) String() string { return joinTagExprs(o, " OR ") }
+
+func joinTagExprs(exprs []TagExpr, sep string) string {
+	parts := make([]string, len(exprs))
+	for i, expr := range exprs {
+		parts[i] = expr.String()
+	}
+	return "(" + strings.Join(parts, sep) + ")"
+}
+
+// ParseTagExpr parses a tag expression.
+func ParseTagExpr(s string) (TagExpr, error) {
+	p := &tagParser{tokens: tokenizeTagExpr(s)}
+	if len(p.tokens) == 0 {
+		return nil, fmt.Errorf("empty tag expression")
+	}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected '%s' in tag expression '%s'", p.tokens[p.pos], s)
+	}
+	return expr, nil
+}
+
+// tokenizeTagExpr splits on whitespace, keeping parentheses as tokens.
+func tokenizeTagExpr(s string) []string {
+	s = strings.NewReplacer("(", " ( ", ")", " ) ").Replace(s)
+	return strings.Fields(s)
+}
+
+type tagParser struct {
+	tokens []string
+	pos    int
+}
+
+// accept consumes the next token if it is the keyword (case-insensitive).
+func (p *tagParser) accept(keyword string) bool {
+	if p.pos < len(p.tokens) && strings.EqualFold(p.tokens[p.pos], keyword) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *tagParser) parseOr() (TagExpr, error) {
+	expr, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	or := tagOr{expr}
+	for p.accept("OR") {
+		if expr, err = p.parseAnd(); err != nil {
+			return nil, err
+		}
+		or = append(or, expr)
+	}
+	if len(or) == 1 {
+		return or[0], nil
+	}
+	return or, nil
+}
+
+func (p *tagParser) parseAnd() (TagExpr, error) {
+	expr, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	and := tagAnd{expr}
+	for p.accept("AND") {
+		if expr, err = p.parseUnary(); err != nil {
+			return nil, err
+		}
+		and = append(and, expr)
+	}
+	if len(and) == 1 {
+		return and[0], nil
+	}
+	return and, nil
+}
+
+func (p *tagParser) parseUnary() (TagExpr, error) {
+	if p.accept("NOT") {
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return tagNot{expr}, nil
+	}
+	if p.accept("(") {
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, fmt.Errorf("missing ')' in tag expression")
+		}
+		return expr, nil
+	}
+	if p.pos >= len(p.tokens) {
+		return nil, fmt.Errorf("tag expression ends unexpectedly")
+	}
+	token := p.tokens[p.pos]
+	for _, keyword := range []string{"AND", "OR", ")"} {
+		if strings.EqualFold(token, keyword) {
+			return nil, fmt.Errorf("expected a tag before '%s'", token)
+		}
+	}
+	p.pos++
+	return tagTerm(token), nil
+}
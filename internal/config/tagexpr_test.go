@@ -0,0 +1,94 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseTagExpr(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		want string // String() of the parsed expression, which shows grouping
+	}{
+		{name: "term", expr: "archive:true", want: "archive:true"},
+		{name: "and", expr: "archive:true AND region:us", want: "(archive:true AND region:us)"},
+		{name: "or", expr: "region:us OR region:eu", want: "(region:us OR region:eu)"},
+		{name: "not", expr: "NOT trace", want: "NOT trace"},
+		{name: "double not", expr: "NOT NOT trace", want: "NOT NOT trace"},
+		{name: "and binds tighter than or", expr: "a OR b AND c", want: "(a OR (b AND c))"},
+		{name: "parentheses", expr: "(a OR b) AND c", want: "((a OR b) AND c)"},
+		{name: "not binds tightest", expr: "NOT a AND b", want: "(NOT a AND b)"},
+		{name: "keywords in any case", expr: "a and not b Or c", want: "((a AND NOT b) OR c)"},
+		{name: "parentheses without spaces", expr: "(a)AND(b)", want: "(a AND b)"},
+		{name: "chained and", expr: "a AND b AND c", want: "(a AND b AND c)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := ParseTagExpr(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseTagExpr(%q) failed: %v", tt.expr, err)
+			}
+			if got := expr.String(); got != tt.want {
+				t.Errorf("ParseTagExpr(%q) = %s, want %s", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTagExprErrors(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr string
+	}{
+		{expr: "", wantErr: "empty tag expression"},
+		{expr: "   ", wantErr: "empty tag expression"},
+		{expr: "a AND", wantErr: "ends unexpectedly"},
+		{expr: "NOT", wantErr: "ends unexpectedly"},
+		{expr: "AND a", wantErr: "expected a tag before 'AND'"},
+		{expr: "a OR or b", wantErr: "expected a tag before 'or'"},
+		{expr: "(a OR b", wantErr: "missing ')'"},
+		{expr: "a)", wantErr: "unexpected ')'"},
+		{expr: "a b", wantErr: "unexpected 'b'"},
+		{expr: "()", wantErr: "expected a tag before ')'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := ParseTagExpr(tt.expr)
+			if err == nil {
+				t.Fatalf("ParseTagExpr(%q) succeeded, want an error containing %q", tt.expr, tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseTagExpr(%q) error = %q, want it to contain %q", tt.expr, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTagExprMatch(t *testing.T) {
+	tags := map[string]bool{"archive:true": true, "region:us": true}
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{expr: "archive:true", want: true},
+		{expr: "trace", want: false},
+		{expr: "archive:true AND region:us", want: true},
+		{expr: "archive:true AND region:eu", want: false},
+		{expr: "region:eu OR region:us", want: true},
+		{expr: "NOT region:eu", want: true},
+		{expr: "NOT (archive:true AND region:us)", want: false},
+		{expr: "trace OR archive:true AND NOT region:eu", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			expr, err := ParseTagExpr(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseTagExpr(%q) failed: %v", tt.expr, err)
+			}
+			if got := expr.Match(tags); got != tt.want {
+				t.Errorf("%s matches %v: got %v, want %v", tt.expr, tags, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package gateway
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"rpc-load-balancer/internal/config"
+	"rpc-load-balancer/internal/types"
+	"slices"
+	"strings"
+)
+
+// maxAdminBodyBytes bounds the body of admin API requests.
+const maxAdminBodyBytes = 64 << 10
+
+// AdminHandler serves the admin API under /admin/. Reads are open like the
+// other admin routes; changes require the adminToken as a bearer token.
+func (gw *Gateway) AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("GET /admin/endpoints", gw.EndpointsHandler())
+	mux.Handle("POST /admin/endpoints", gw.requireAdminToken(http.HandlerFunc(gw.serveAddEndpoint)))
+	mux.Handle("POST /admin/recheck", gw.requireAdminToken(http.HandlerFunc(gw.serveRecheck)))
+	return mux
+}
+
+// requireAdminToken only passes requests carrying the adminToken as a bearer
+// token. Without an adminToken every request is refused.
+func (gw *Gateway) requireAdminToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if gw.config.AdminToken == "" {
+			http.Error(w, "admin changes are disabled: no adminToken configured", http.StatusForbidden)
+			return
+		}
+		if !checkBearerToken(w, r, gw.config.AdminToken) {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// checkBearerToken reports whether the request carries token as a bearer
+// token, answering 401 if it does not.
+func checkBearerToken(w http.ResponseWriter, r *http.Request, token string) bool {
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "invalid or missing admin token", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// serveRecheck runs a selection pass and answers with the resulting best
+// endpoint once it is done.
+func (gw *Gateway) serveRecheck(w http.ResponseWriter, r *http.Request) {
+	log.Printf("🛠️ Re-check requested through the admin API by %s", r.RemoteAddr)
+	gw.SelectBestEndpoint()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"best": endpointLabel(gw.GetBestEndpoint())})
+}
+
+// serveAddEndpoint adds the endpoint in the request body to the pool.
+func (gw *Gateway) serveAddEndpoint(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxAdminBodyBytes))
+	if err != nil {
+		http.Error(w, "failed to read request body", http.StatusBadRequest)
+		return
+	}
+	epCfg, err := gw.config.ParseEndpoint(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := gw.AddEndpoint(epCfg); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	log.Printf("🛠️ Endpoint %s added through the admin API by %s", redactURL(epCfg.URL), r.RemoteAddr)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// AddEndpoint adds an endpoint to the running gateway. Its chain ID is
+// verified first; otherwise it joins the pool unchecked and is ranked by the
+// selection pass started here. The endpoint
+// is not written to the configuration file, so a reload drops it.
+func (gw *Gateway) AddEndpoint(epCfg config.EndpointConfig) error {
+	gw.endpointsMu.Lock()
+	defer gw.endpointsMu.Unlock()
+
+	old := gw.endpoints()
+	if slices.ContainsFunc(old, func(ep *types.RpcEndpoint) bool { return ep.Config.URL == epCfg.URL }) {
+		return fmt.Errorf("endpoint %s already exists", redactURL(epCfg.URL))
+	}
+	ep, err := gw.newEndpoint(gw.config, epCfg)
+	if err != nil {
+		return fmt.Errorf("invalid endpoint URL %s: %w", redactURL(epCfg.URL), err)
+	}
+	if err := gw.checkAddedChainID(ep, old); err != nil {
+		return err
+	}
+	publishEndpointMetrics(ep, false)
+	gw.endpointSet.Store(gw.newEndpointSet(append(slices.Clip(old), ep)))
+	go gw.SelectBestEndpoint()
+	return nil
+}
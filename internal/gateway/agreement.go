@@ -0,0 +1,118 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"rpc-load-balancer/internal/logging"
+	"rpc-load-balancer/internal/metrics"
+	"rpc-load-balancer/internal/types"
+	"sync"
+	"time"
+)
+
+// StartAgreementMonitor periodically compares the answers of all healthy
+// endpoints to the configured query, if the agreement monitor is enabled.
+// It stops when ctx is cancelled.
+func (gw *Gateway) StartAgreementMonitor(ctx context.Context) {
+	cfg := gw.config.AgreementMonitor
+	if !cfg.Enabled {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(cfg.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				gw.checkAgreement()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	log.Printf("Agreement monitor started (Query: %s, Interval: %v).", cfg.Query.Method, cfg.Interval)
+}
+
+// checkAgreement sends the agreement query to every healthy endpoint and
+// records, for each pair that answered, whether their results match.
+func (gw *Gateway) checkAgreement() {
+	var healthy []*types.RpcEndpoint
+	for _, ep := range gw.endpoints() {
+		ep.Mutex.RLock()
+		if ep.IsReachable && !ep.IsRateLimited && !ep.HasCredentialError {
+			healthy = append(healthy, ep)
+		}
+		ep.Mutex.RUnlock()
+	}
+	if len(healthy) < 2 {
+		return
+	}
+
+	results := make([]string, len(healthy))
+	answered := make([]bool, len(healthy))
+	var wg sync.WaitGroup
+	for i, ep := range healthy {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res := gw.probe(ep, gw.config.AgreementMonitor.Query)
+			if res.reason != "" {
+				logging.Limitedf("Agreement query failed: %s", res.message)
+				return
+			}
+			results[i], answered[i] = normalizeResult(res.result), true
+		}()
+	}
+	wg.Wait()
+
+	disagreements := make(map[*types.RpcEndpoint]int)
+	for i := range healthy {
+		for j := i + 1; j < len(healthy); j++ {
+			if !answered[i] || !answered[j] {
+				continue
+			}
+			a, b := healthy[i].URL.String(), healthy[j].URL.String()
+			if results[i] == results[j] {
+				metrics.RpcEndpointAgreement.WithLabelValues(a, b).Set(1)
+				metrics.RpcEndpointAgreementTotal.WithLabelValues(a, b, "agree").Inc()
+				continue
+			}
+			metrics.RpcEndpointAgreement.WithLabelValues(a, b).Set(0)
+			metrics.RpcEndpointAgreementTotal.WithLabelValues(a, b, "disagree").Inc()
+			disagreements[healthy[i]]++
+			disagreements[healthy[j]]++
+		}
+	}
+
+	// An endpoint disagreeing with every peer is the likely outlier
+	for i, ep := range healthy {
+		peers := 0
+		for j := range healthy {
+			if j != i && answered[j] {
+				peers++
+			}
+		}
+		if answered[i] && peers > 1 && disagreements[ep] == peers {
+			log.Printf("⚖️ %s disagrees with all %d peers on %s: %s", ep.URL.String(), peers, gw.config.AgreementMonitor.Query.Method, results[i])
+		}
+	}
+}
+
+// normalizeResult re-encodes a JSON result so that formatting and object key
+// order do not count as disagreement.
+func normalizeResult(result json.RawMessage) string {
+	dec := json.NewDecoder(bytes.NewReader(result))
+	dec.UseNumber() // Keep large numbers exact
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return string(result)
+	}
+	normalized, err := json.Marshal(v)
+	if err != nil {
+		return string(result)
+	}
+	return string(normalized)
+}
@@ -0,0 +1,87 @@
+package gateway
+
+import (
+	"math"
+	"math/rand/v2"
+	"rpc-load-balancer/internal/config"
+	"rpc-load-balancer/internal/types"
+	"time"
+)
+
+// minBalanceCost keeps near-zero latencies from giving an endpoint an
+// unbounded share of the traffic.
+const minBalanceCost = float64(100 * time.Microsecond)
+
+// weightedPool is the set of endpoints requests are spread over in weighted
+// load balancing mode, with their cumulative traffic shares.
+type weightedPool struct {
+	endpoints  []*types.RpcEndpoint
+	cumWeights []float64
+}
+
+// updatePool rebuilds the weighted pool from the ranked candidates of a
+// selection pass. Only candidates in the same priority group, region tier,
+// error demotion and quota state as the best take part, so priorities,
+// preferredRegions, maxErrorRate and quota headroom keep applying.
+// Each gets a share proportional to the inverse of its ranking cost.
+func (gw *Gateway) updatePool(best *types.RpcEndpoint, ranked []*types.RpcEndpoint) {
+	if gw.config.LoadBalancing != config.LoadBalancingWeighted {
+		return
+	}
+	best.Mutex.RLock()
+	priority, rank, demoted, quotaLow := best.Config.Priority, gw.regionRank(best), best.RpcErrorDemoted, isQuotaLow(best)
+	best.Mutex.RUnlock()
+
+	pool := &weightedPool{}
+	total := 0.0
+	for _, ep := range ranked {
+		ep.Mutex.RLock()
+		sameTier := ep.Config.Priority == priority && gw.regionRank(ep) == rank &&
+			ep.RpcErrorDemoted == demoted && isQuotaLow(ep) == quotaLow
+		cost := gw.rankingCost(ep)
+		ep.Mutex.RUnlock()
+		if !sameTier || math.IsInf(cost, 1) && ep != best {
+			continue
+		}
+		total += 1 / max(cost, minBalanceCost)
+		pool.endpoints = append(pool.endpoints, ep)
+		pool.cumWeights = append(pool.cumWeights, total)
+	}
+	gw.pool.Store(pool)
+}
+
+// pickEndpoint returns the endpoint for a new request from clientIP: with
+// sticky sessions the client's endpoint, else the current best, or in
+// weighted mode a weighted random member of the pool that is still healthy,
+// falling back to the best.
+func (gw *Gateway) pickEndpoint(clientIP string) *types.RpcEndpoint {
+	if gw.sticky != nil {
+		return gw.stickyEndpoint(clientIP)
+	}
+	best := gw.GetBestEndpoint()
+	pool := gw.pool.Load()
+	if pool == nil || len(pool.endpoints) < 2 {
+		return best
+	}
+
+	target := rand.Float64() * pool.cumWeights[len(pool.cumWeights)-1]
+	ep := pool.endpoints[len(pool.endpoints)-1]
+	for i, cum := range pool.cumWeights {
+		if target < cum {
+			ep = pool.endpoints[i]
+			break
+		}
+	}
+	if !gw.servable(ep) {
+		return best
+	}
+	return ep
+}
+
+// servable reports whether a pool member picked for a request is still
+// healthy enough to serve it.
+func (gw *Gateway) servable(ep *types.RpcEndpoint) bool {
+	ep.Mutex.RLock()
+	defer ep.Mutex.RUnlock()
+	return ep.IsReachable && !ep.IsRateLimited && !ep.HasCredentialError && !gw.excludedBySync(ep)
+}
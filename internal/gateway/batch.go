@@ -0,0 +1,257 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"rpc-load-balancer/internal/config"
+	"rpc-load-balancer/internal/types"
+	"strconv"
+	"sync"
+)
+
+// batchErrorCode returns the JSON-RPC error code for an errInvalidBatch:
+// a parse error when the array is not valid JSON, else an invalid request.
+func batchErrorCode(err error) int {
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return rpcCodeParseError
+	}
+	return rpcCodeInvalidRequest
+}
+
+// batchPart is a group of calls from a split batch that share a routing
+// rule, and the response collected for them.
+type batchPart struct {
+	calls []types.JsonRpcRequest
+	resp  *batchPartWriter
+	err   *types.JsonRpcError // Set when the part could not be sent
+}
+
+// splitBatch groups the calls of a batch by the routing rule they match,
+// keeping their order within each group.
+func (gw *Gateway) splitBatch(payload *rpcPayload, best *types.RpcEndpoint) []*batchPart {
+	var parts []*batchPart
+	byRule := make(map[*config.RoutingRule]*batchPart)
+	for _, call := range payload.Calls {
+		rule := gw.routingRuleFor(&rpcPayload{Calls: []types.JsonRpcRequest{call}, IsBatch: true}, best)
+		part, ok := byRule[rule]
+		if !ok {
+			part = &batchPart{}
+			byRule[rule] = part
+			parts = append(parts, part)
+		}
+		part.calls = append(part.calls, call)
+	}
+	return parts
+}
+
+// serveSplitBatch sends the calls of a batch that routing rules assign to
+// different endpoints as separate sub-batches, concurrently and through the
+// regular proxy, and answers with the merged replies, including the errors
+// for calls methodFilter denied. A batch whose calls all share a route and
+// were all allowed is proxied whole.
+func (gw *Gateway) serveSplitBatch(proxy http.Handler, w http.ResponseWriter, r *http.Request, state *requestState) {
+	var parts []*batchPart
+	if gw.config.SplitBatches {
+		parts = gw.splitBatch(state.payload, state.endpoint)
+	} else if len(state.payload.Calls) > 0 {
+		parts = []*batchPart{{calls: state.payload.Calls}}
+	}
+	if len(parts) == 1 && state.denied == nil {
+		ep, reason := gw.routeRequest(state)
+		if ep == nil {
+			gw.writeError(w, r, http.StatusServiceUnavailable, rpcCodeServerError, reason)
+			return
+		}
+		state.endpoint = ep
+		proxy.ServeHTTP(w, r)
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, part := range parts {
+		wg.Add(1)
+		go func(part *batchPart) {
+			defer wg.Done()
+			gw.sendBatchPart(proxy, r, state, part)
+		}(part)
+	}
+	wg.Wait()
+
+	payload := state.payload
+	if state.denied != nil {
+		parts = append(parts, state.denied)
+		payload = state.unfiltered
+	}
+	replies := mergeBatchReplies(payload, parts)
+	if len(replies) == 0 {
+		// Only notifications, as for an unsplit batch
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	body, err := json.Marshal(replies)
+	if err != nil {
+		gw.writeError(w, r, http.StatusInternalServerError, rpcCodeInternalError, "failed to encode batch response")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// sendBatchPart routes one part of a split batch and proxies it as a batch
+// of its own, recording the response in the part.
+func (gw *Gateway) sendBatchPart(proxy http.Handler, r *http.Request, state *requestState, part *batchPart) {
+	payload := &rpcPayload{Calls: part.calls, IsBatch: true}
+	sub := &requestState{
+		clientIP:     state.clientIP,
+		requestID:    state.requestID,
+		endpoint:     state.endpoint,
+		path:         state.path,
+		payload:      payload,
+		method:       state.method,
+		variant:      state.variant,
+		clientHeader: state.clientHeader,
+	}
+	ep, reason := gw.routeRequest(sub)
+	if ep == nil {
+		part.err = &types.JsonRpcError{Code: rpcCodeServerError, Message: reason}
+		return
+	}
+	sub.endpoint = ep
+
+	data, err := payload.encode()
+	if err != nil {
+		part.err = &types.JsonRpcError{Code: rpcCodeInternalError, Message: "failed to encode batch part"}
+		return
+	}
+	sub.body = newMemoryBody(data)
+	req := r.Clone(context.WithValue(r.Context(), stateContextKey, sub))
+	req.Body = sub.body.NewReader()
+	req.ContentLength = sub.body.Len()
+	// The replies are decoded and merged, so let the transport handle compression
+	req.Header.Del("Accept-Encoding")
+
+	part.resp = newBatchPartWriter()
+	defer func() {
+		// The proxy aborts with a panic when the upstream fails mid-response
+		if v := recover(); v != nil {
+			if v != http.ErrAbortHandler {
+				panic(v)
+			}
+			part.resp = nil
+			part.err = &types.JsonRpcError{Code: rpcCodeServerError, Message: "upstream response interrupted"}
+		}
+	}()
+	proxy.ServeHTTP(part.resp, req)
+}
+
+// entries returns the reply entries of a part. A part that failed, or was
+// not answered with a JSON array, gets an error entry per call instead,
+// carrying the error of a single JSON-RPC error reply when there is one.
+func (part *batchPart) entries() []json.RawMessage {
+	rpcErr := part.err
+	if rpcErr == nil {
+		switch resp := part.resp; {
+		case resp.status == http.StatusNoContent:
+			return nil
+		case resp.status == http.StatusOK:
+			var entries []json.RawMessage
+			if json.Unmarshal(resp.body.Bytes(), &entries) == nil {
+				return entries
+			}
+			fallthrough
+		default:
+			var reply types.JsonRpcResponse
+			if json.Unmarshal(resp.body.Bytes(), &reply) == nil && reply.Error != nil {
+				rpcErr = reply.Error
+			} else {
+				rpcErr = &types.JsonRpcError{Code: rpcCodeServerError, Message: fmt.Sprintf("upstream answered HTTP %d", resp.status)}
+			}
+		}
+	}
+
+	var entries []json.RawMessage
+	for _, call := range part.calls {
+		if isNotification(call) {
+			continue
+		}
+		entry, err := json.Marshal(types.JsonRpcResponse{Jsonrpc: "2.0", Error: rpcErr, ID: call.ID})
+		if err == nil {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// mergeBatchReplies combines the replies of all parts into one batch
+// response, ordered like the calls of the original batch. Replies whose id
+// matches no call are appended at the end.
+func mergeBatchReplies(payload *rpcPayload, parts []*batchPart) []json.RawMessage {
+	var entries []json.RawMessage
+	byID := make(map[string][]int) // Indexes into entries, in reply order
+	for _, part := range parts {
+		for _, entry := range part.entries() {
+			var reply struct {
+				ID json.RawMessage `json:"id"`
+			}
+			if json.Unmarshal(entry, &reply) == nil && reply.ID != nil {
+				key := idKey(reply.ID)
+				byID[key] = append(byID[key], len(entries))
+			}
+			entries = append(entries, entry)
+		}
+	}
+
+	merged := make([]json.RawMessage, 0, len(entries))
+	used := make([]bool, len(entries))
+	for _, call := range payload.Calls {
+		if isNotification(call) {
+			continue
+		}
+		key := idKey(call.ID)
+		if queued := byID[key]; len(queued) > 0 {
+			merged = append(merged, entries[queued[0]])
+			used[queued[0]] = true
+			byID[key] = queued[1:]
+		}
+	}
+	for i, entry := range entries {
+		if !used[i] {
+			merged = append(merged, entry)
+		}
+	}
+	return merged
+}
+
+// batchPartWriter buffers the proxied response to one part of a split batch.
+type batchPartWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newBatchPartWriter() *batchPartWriter {
+	return &batchPartWriter{header: make(http.Header)}
+}
+
+func (w *batchPartWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *batchPartWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *batchPartWriter) Write(p []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(p)
+}
@@ -0,0 +1,126 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"rpc-load-balancer/internal/config"
+	"rpc-load-balancer/internal/metrics"
+)
+
+// blockTagFields are the fields of object parameters that may hold a block
+// tag: eth_getLogs style filters and EIP-1898 block parameters.
+var blockTagFields = []string{"fromBlock", "toBlock", "blockNumber"}
+
+// applyBlockTags enforces the blockTags rules on every call of the payload,
+// rewriting parameters in place. It reports whether any call was changed and
+// returns an error naming the first rejected tag.
+func (gw *Gateway) applyBlockTags(payload *rpcPayload) (bool, error) {
+	if len(gw.config.BlockTags) == 0 {
+		return false, nil
+	}
+
+	changed := false
+	for i := range payload.Calls {
+		call := &payload.Calls[i]
+		var params []json.RawMessage
+		if json.Unmarshal(call.Params, &params) != nil {
+			continue // No positional params, nothing to check
+		}
+
+		callChanged := false
+		for j, param := range params {
+			var rewritten bool
+			var err error
+			switch {
+			case len(param) > 0 && param[0] == '"':
+				params[j], rewritten, err = gw.checkBlockTag(call.Method, param)
+			case len(param) > 0 && param[0] == '{':
+				params[j], rewritten, err = gw.checkBlockTagFields(call.Method, param)
+			}
+			if err != nil {
+				return false, err
+			}
+			callChanged = callChanged || rewritten
+		}
+		if !callChanged {
+			continue
+		}
+		encoded, err := json.Marshal(params)
+		if err != nil {
+			return false, err
+		}
+		call.Params = encoded
+		changed = true
+	}
+	return changed, nil
+}
+
+// checkBlockTagFields applies checkBlockTag to the block fields of an object
+// parameter.
+func (gw *Gateway) checkBlockTagFields(method string, param json.RawMessage) (json.RawMessage, bool, error) {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(param, &fields) != nil {
+		return param, false, nil
+	}
+
+	changed := false
+	for _, name := range blockTagFields {
+		value, ok := fields[name]
+		if !ok {
+			continue
+		}
+		out, rewritten, err := gw.checkBlockTag(method, value)
+		if err != nil {
+			return nil, false, err
+		}
+		if rewritten {
+			fields[name] = out
+			changed = true
+		}
+	}
+	if !changed {
+		return param, false, nil
+	}
+	encoded, err := json.Marshal(fields)
+	if err != nil {
+		return nil, false, err
+	}
+	return encoded, true, nil
+}
+
+// checkBlockTag applies the rule for a single parameter value. Values other
+// than strings, such as hex block numbers wrapped in objects, pass through.
+func (gw *Gateway) checkBlockTag(method string, value json.RawMessage) (json.RawMessage, bool, error) {
+	var tag string
+	if json.Unmarshal(value, &tag) != nil {
+		return value, false, nil
+	}
+
+	action := gw.blockTagAction(method, tag)
+	switch action {
+	case config.BlockTagAllow, tag:
+		return value, false, nil
+	case config.BlockTagReject:
+		metrics.RpcBlockTagActionsTotal.WithLabelValues(metrics.MethodLabel(method), tag, action, gw.chain).Inc()
+		return nil, false, fmt.Errorf("block tag '%s' is not allowed for %s", tag, method)
+	}
+
+	metrics.RpcBlockTagActionsTotal.WithLabelValues(metrics.MethodLabel(method), tag, "rewrite", gw.chain).Inc()
+	encoded, err := json.Marshal(action)
+	if err != nil {
+		return nil, false, err
+	}
+	return encoded, true, nil
+}
+
+// blockTagAction returns the configured action for tag in method, preferring
+// the method's own rules over the "*" rules. Unlisted tags are allowed.
+func (gw *Gateway) blockTagAction(method, tag string) string {
+	if action, ok := gw.config.BlockTags[method][tag]; ok {
+		return action
+	}
+	if action, ok := gw.config.BlockTags[config.BlockTagsAnyMethod][tag]; ok {
+		return action
+	}
+	return config.BlockTagAllow
+}
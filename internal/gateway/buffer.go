@@ -0,0 +1,199 @@
+package gateway
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"rpc-load-balancer/internal/config"
+	"rpc-load-balancer/internal/metrics"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxPooledBufferSize keeps unusually large buffers out of the pool so a few
+// big requests do not pin memory for the life of the process.
+const maxPooledBufferSize = 1 << 20
+
+var bufferPool = sync.Pool{
+	New: func() any {
+		metrics.RpcRequestBuffersTotal.WithLabelValues("pool_miss").Inc()
+		return new(bytes.Buffer)
+	},
+}
+
+// requestBody is a buffered client request body that can be replayed for
+// every upstream attempt. It lives in memory, in a pooled buffer, or in a
+// temporary file when it exceeds the spill threshold.
+type requestBody struct {
+	data   []byte
+	pooled *bytes.Buffer // Returned to bufferPool on release
+	file   *os.File      // Set when the body was spilled to disk
+	size   int64
+	refs   atomic.Int32 // References held besides the owner's, see retain
+}
+
+// newMemoryBody wraps an already encoded body, e.g. one rewritten by the gateway.
+func newMemoryBody(data []byte) *requestBody {
+	return &requestBody{data: data, size: int64(len(data))}
+}
+
+// readBody buffers the request body under the configured read deadline, so a
+// client trickling its body cannot hold the connection and buffer forever.
+// A timeout surfaces as an error wrapping os.ErrDeadlineExceeded.
+func (gw *Gateway) readBody(w http.ResponseWriter, r *http.Request) (*requestBody, error) {
+	timeout := gw.config.RequestBuffer.ReadTimeout
+	if timeout <= 0 {
+		return gw.bufferBody(r.Body, r.ContentLength)
+	}
+
+	rc := http.NewResponseController(w)
+	if err := rc.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		// The connection does not support deadlines; read without one
+		return gw.bufferBody(r.Body, r.ContentLength)
+	}
+	body, err := gw.bufferBody(r.Body, r.ContentLength)
+	if err != nil {
+		// Keep the deadline so closing the body does not wait on the client
+		return nil, err
+	}
+	rc.SetReadDeadline(time.Time{})
+	return body, nil
+}
+
+// bufferBody reads the whole body using the configured buffering strategy.
+// contentLength may be -1 when the client did not announce it.
+func (gw *Gateway) bufferBody(r io.Reader, contentLength int64) (*requestBody, error) {
+	cfg := gw.config.RequestBuffer
+	threshold := cfg.SpillThreshold
+
+	if threshold > 0 && contentLength > threshold {
+		return spillBody(nil, r)
+	}
+
+	var buf *bytes.Buffer
+	if cfg.Strategy == config.BufferPooled {
+		buf = bufferPool.Get().(*bytes.Buffer)
+		buf.Reset()
+		metrics.RpcRequestBuffersTotal.WithLabelValues("pooled").Inc()
+	} else {
+		buf = new(bytes.Buffer)
+		metrics.RpcRequestBuffersTotal.WithLabelValues("memory").Inc()
+	}
+	body := &requestBody{}
+	if cfg.Strategy == config.BufferPooled {
+		body.pooled = buf
+	}
+
+	var err error
+	if threshold > 0 {
+		// Read one byte past the threshold to find out whether to spill
+		_, err = io.CopyN(buf, r, threshold+1)
+		if errors.Is(err, io.EOF) {
+			err = nil
+		} else if err == nil {
+			spilled, spillErr := spillBody(buf.Bytes(), r)
+			body.release()
+			return spilled, spillErr
+		}
+	} else {
+		_, err = buf.ReadFrom(r)
+	}
+	if err != nil {
+		body.release()
+		return nil, err
+	}
+
+	body.data = buf.Bytes()
+	body.size = int64(buf.Len())
+	return body, nil
+}
+
+// spillBody writes head followed by the rest of r to a temporary file.
+func spillBody(head []byte, r io.Reader) (*requestBody, error) {
+	metrics.RpcRequestBuffersTotal.WithLabelValues("spill").Inc()
+
+	file, err := os.CreateTemp("", "rpc-gateway-body-*")
+	if err != nil {
+		return nil, err
+	}
+	body := &requestBody{file: file}
+
+	n, err := file.Write(head)
+	body.size = int64(n)
+	if err == nil {
+		var rest int64
+		rest, err = io.Copy(file, r)
+		body.size += rest
+	}
+	if err != nil {
+		body.release()
+		return nil, err
+	}
+	return body, nil
+}
+
+// Len returns the size of the body in bytes.
+func (b *requestBody) Len() int64 {
+	return b.size
+}
+
+// NewReader returns an independent reader over the whole body.
+func (b *requestBody) NewReader() io.ReadCloser {
+	if b.file != nil {
+		return io.NopCloser(io.NewSectionReader(b.file, 0, b.size))
+	}
+	return io.NopCloser(bytes.NewReader(b.data))
+}
+
+// Bytes returns the body contents, reading them back from disk if spilled.
+func (b *requestBody) Bytes() ([]byte, error) {
+	if b.file == nil {
+		return b.data, nil
+	}
+	return io.ReadAll(b.NewReader())
+}
+
+// retain wraps r so that it keeps the body's storage alive until r is
+// closed. Attempts that may outlive the request, such as the losing side of a
+// hedged request, read the body through such a reader.
+func (b *requestBody) retain(r io.ReadCloser) io.ReadCloser {
+	b.refs.Add(1)
+	return &retainedReader{ReadCloser: r, body: b}
+}
+
+// release frees the body's storage once the owner and every reader returned
+// by retain are done with it. The body must not be used afterwards.
+func (b *requestBody) release() {
+	if b.refs.Add(-1) >= 0 {
+		return
+	}
+	if b.pooled != nil {
+		if b.pooled.Cap() <= maxPooledBufferSize {
+			bufferPool.Put(b.pooled)
+		}
+		b.pooled = nil
+		b.data = nil
+	}
+	if b.file != nil {
+		b.file.Close()
+		os.Remove(b.file.Name())
+		b.file = nil
+	}
+}
+
+// retainedReader drops its reference to a body when closed.
+type retainedReader struct {
+	io.ReadCloser
+	body *requestBody
+	once sync.Once
+}
+
+// Close implements io.Closer.
+func (r *retainedReader) Close() error {
+	err := r.ReadCloser.Close()
+	r.once.Do(r.body.release)
+	return err
+}
@@ -0,0 +1,165 @@
+package gateway
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/json"
+	"io"
+	"net/http"
+	"rpc-load-balancer/internal/metrics"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// responseCache is an LRU cache of JSON-RPC results, keyed by request path,
+// method and normalized params.
+type responseCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[string]*list.Element
+	order      *list.List // Front is the most recently used
+}
+
+type cacheEntry struct {
+	key     string
+	result  json.RawMessage
+	expires time.Time // Zero when the entry never expires
+}
+
+// newResponseCache creates a cache, or returns nil when no method is cacheable.
+func newResponseCache(cacheable map[string]time.Duration, maxEntries int) *responseCache {
+	if len(cacheable) == 0 {
+		return nil
+	}
+	return &responseCache{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+	}
+}
+
+// get returns the cached result for key, if it is present and not expired.
+func (c *responseCache) get(key string, now time.Time) (json.RawMessage, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if !entry.expires.IsZero() && now.After(entry.expires) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return entry.result, true
+}
+
+// put stores a result, evicting the least recently used entry when full.
+func (c *responseCache) put(key string, result json.RawMessage, expires time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = &cacheEntry{key: key, result: result, expires: expires}
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, result: result, expires: expires})
+	if c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// cacheKey returns the cache key of a request, or "" when it is not
+// cacheable: only single calls to a cacheableMethods method with an id are.
+// Params are re-encoded so that formatting, object key order and a missing
+// params member do not matter.
+func (gw *Gateway) cacheKey(state *requestState) string {
+	if gw.cache == nil || state.payload == nil || state.payload.IsBatch || len(state.payload.Calls) != 1 {
+		return ""
+	}
+	call := state.payload.Calls[0]
+	if _, ok := gw.config.CacheTTLs[call.Method]; !ok || isNotification(call) {
+		return ""
+	}
+	params := []byte("[]") // Missing or null params mean no params
+	var decoded any
+	if len(call.Params) > 0 {
+		// Numbers are kept as written: as float64, distinct large integers
+		// could round to the same key
+		dec := json.NewDecoder(bytes.NewReader(call.Params))
+		dec.UseNumber()
+		if err := dec.Decode(&decoded); err != nil {
+			return ""
+		}
+	}
+	if decoded != nil {
+		params, _ = json.Marshal(decoded)
+	}
+	return state.path + "\x00" + call.Method + "\x00" + string(params)
+}
+
+// serveCached answers the request from the cache and reports whether it did.
+// Cache hits and misses are counted here.
+func (gw *Gateway) serveCached(w http.ResponseWriter, state *requestState) bool {
+	call := state.payload.Calls[0]
+	method := metrics.MethodLabel(call.Method)
+	result, ok := gw.cache.get(state.cacheKey, time.Now())
+	if !ok {
+		metrics.RpcCacheMissesTotal.WithLabelValues(method, gw.chain).Inc()
+		return false
+	}
+	metrics.RpcCacheHitsTotal.WithLabelValues(method, gw.chain).Inc()
+
+	body, err := json.Marshal(struct {
+		Jsonrpc string          `json:"jsonrpc"`
+		ID      json.RawMessage `json:"id"`
+		Result  json.RawMessage `json:"result"`
+	}{"2.0", call.ID, result})
+	if err != nil {
+		return false
+	}
+	state.cached = true
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.Header().Set("X-Rpc-Gateway-Cache", "hit")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+	return true
+}
+
+// storeResponse caches the result of a successful reply to a cacheable
+// request. Errors and null results, such as the receipt of a transaction not
+// mined yet, are not cached.
+func (gw *Gateway) storeResponse(resp *http.Response, state *requestState) error {
+	if resp.StatusCode != http.StatusOK {
+		return nil
+	}
+	if enc := resp.Header.Get("Content-Encoding"); enc != "" && enc != "identity" {
+		return nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	replaceBody(resp, body)
+
+	var reply struct {
+		Result json.RawMessage `json:"result"`
+		Error  json.RawMessage `json:"error"`
+	}
+	if json.Unmarshal(body, &reply) != nil || reply.Error != nil || len(reply.Result) == 0 || bytes.Equal(reply.Result, []byte("null")) {
+		return nil
+	}
+	var expires time.Time
+	if ttl := gw.config.CacheTTLs[state.payload.Calls[0].Method]; ttl > 0 {
+		expires = time.Now().Add(ttl)
+	}
+	gw.cache.put(state.cacheKey, reply.Result, expires)
+	return nil
+}
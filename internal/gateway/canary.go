@@ -0,0 +1,45 @@
+package gateway
+
+import (
+	"log"
+	"math/rand/v2"
+	"rpc-load-balancer/internal/metrics"
+	"rpc-load-balancer/internal/types"
+)
+
+// canaryEndpoint returns the canary if this read-only request should be sent
+// to it, else nil.
+func (gw *Gateway) canaryEndpoint(state *requestState) *types.RpcEndpoint {
+	canary := gw.endpointSet.Load().canary
+	if canary == nil || gw.canaryRolledBack.Load() || state.payload == nil || state.payload.hasWriteCall() {
+		return nil
+	}
+	if rand.Float64()*100 >= gw.config.Canary.Percent {
+		return nil
+	}
+	canary.Mutex.RLock()
+	healthy := canary.IsReachable && !canary.IsRateLimited && !canary.HasCredentialError
+	canary.Mutex.RUnlock()
+	if !healthy {
+		return nil
+	}
+	metrics.RpcCanaryRequestsTotal.WithLabelValues(gw.chain).Inc()
+	return canary
+}
+
+// checkCanary rolls the canary back once its error rate exceeds the limit.
+// The caller must hold the canary's write lock.
+func (gw *Gateway) checkCanary(ep *types.RpcEndpoint) {
+	if ep != gw.endpointSet.Load().canary || gw.canaryRolledBack.Load() {
+		return
+	}
+	cfg := gw.config.Canary
+	metrics.RpcCanaryErrorRate.WithLabelValues(gw.chain).Set(ep.ErrorRate)
+	if ep.Outcomes.Len() < cfg.MinSamples || ep.ErrorRate <= cfg.MaxErrorRate {
+		return
+	}
+	if gw.canaryRolledBack.CompareAndSwap(false, true) {
+		log.Printf("🐤 Canary %s rolled back: error rate %.2f exceeds %.2f", ep.URL.String(), ep.ErrorRate, cfg.MaxErrorRate)
+		metrics.RpcCanaryActive.WithLabelValues(gw.chain).Set(0)
+	}
+}
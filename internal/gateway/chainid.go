@@ -0,0 +1,121 @@
+package gateway
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"rpc-load-balancer/internal/config"
+	"rpc-load-balancer/internal/types"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// chainIDMethod returns the chain an endpoint serves.
+const chainIDMethod = "eth_chainId"
+
+// VerifyChainConsistency asks every endpoint for its chain ID and checks that
+// they all report the same one, and expectedChainId when it is set. This
+// catches endpoints of another network that would otherwise pass the health
+// check. Endpoints that do not answer are skipped with a warning. With
+// chainIdMismatch "fail" a disagreement is returned as an error, with "warn"
+// it is only logged.
+func (gw *Gateway) VerifyChainConsistency() error {
+	endpoints := gw.endpoints()
+	var wg sync.WaitGroup
+	for _, ep := range endpoints {
+		wg.Add(1)
+		go func(ep *types.RpcEndpoint) {
+			defer wg.Done()
+			gw.fetchChainID(ep)
+		}(ep)
+	}
+	wg.Wait()
+
+	byChain := make(map[int64][]string)
+	for _, ep := range endpoints {
+		ep.Mutex.RLock()
+		chainID := ep.ChainID
+		ep.Mutex.RUnlock()
+		if chainID != 0 {
+			byChain[chainID] = append(byChain[chainID], ep.URL.String())
+		}
+	}
+	if len(byChain) == 0 {
+		log.Printf("⚠️ No endpoint answered %s, chain IDs not verified.", chainIDMethod)
+		return nil
+	}
+
+	chainIDs := slices.Sorted(maps.Keys(byChain))
+	expected := gw.config.ExpectedChainID
+	if len(chainIDs) == 1 && (expected == 0 || chainIDs[0] == expected) {
+		log.Printf("🔗 Endpoints report chain ID %d.", chainIDs[0])
+		return nil
+	}
+
+	var parts []string
+	for _, chainID := range chainIDs {
+		parts = append(parts, fmt.Sprintf("%d: %s", chainID, strings.Join(byChain[chainID], ", ")))
+	}
+	err := fmt.Errorf("endpoints report different chain IDs (%s)", strings.Join(parts, "; "))
+	if expected != 0 {
+		err = fmt.Errorf("endpoints do not all report expectedChainId %d (%s)", expected, strings.Join(parts, "; "))
+	}
+	if gw.config.ChainIDMismatch == config.ChainIDMismatchWarn {
+		log.Printf("🚨 WARNING: %v", err)
+		return nil
+	}
+	return err
+}
+
+// fetchChainID queries the endpoint's chain ID and records it on the endpoint.
+func (gw *Gateway) fetchChainID(ep *types.RpcEndpoint) {
+	res := gw.probe(ep, config.HealthCheckMethod{Method: chainIDMethod})
+	if res.reason != "" {
+		log.Printf("⚠️ Could not verify the chain ID of %s: %s", ep.URL, res.message)
+		return
+	}
+	chainID, err := parseQuantity(res.result)
+	if err != nil {
+		log.Printf("⚠️ Could not verify the chain ID of %s: %v", ep.URL, err)
+		return
+	}
+	ep.Mutex.Lock()
+	ep.ChainID = chainID
+	ep.Mutex.Unlock()
+}
+
+// checkAddedChainID verifies that an endpoint joining the running pool
+// reports expectedChainId, or without one the chain ID of the current
+// endpoints. An endpoint that does not answer is let in, as at startup. With
+// chainIdMismatch "fail" a mismatch is returned as an error, with "warn" it
+// is only logged.
+func (gw *Gateway) checkAddedChainID(ep *types.RpcEndpoint, current []*types.RpcEndpoint) error {
+	gw.fetchChainID(ep)
+	ep.Mutex.RLock()
+	chainID := ep.ChainID
+	ep.Mutex.RUnlock()
+
+	expected := gw.config.ExpectedChainID
+	for _, other := range current {
+		if expected != 0 {
+			break
+		}
+		other.Mutex.RLock()
+		expected = other.ChainID
+		other.Mutex.RUnlock()
+	}
+	if chainID == 0 || expected == 0 || chainID == expected {
+		return nil
+	}
+
+	err := fmt.Errorf("endpoint %s reports chain ID %d, expected %d", ep.URL, chainID, expected)
+	if gw.config.ChainIDMismatch == config.ChainIDMismatchWarn {
+		log.Printf("🚨 WARNING: %v", err)
+		return nil
+	}
+	if ep.Transport != nil {
+		ep.Transport.CloseIdleConnections()
+	}
+	return err
+}
@@ -0,0 +1,97 @@
+package gateway
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"rpc-load-balancer/internal/audit"
+	"rpc-load-balancer/internal/config"
+	"rpc-load-balancer/internal/logging"
+	"strings"
+)
+
+// NewGateways creates a gateway per chain of a multi-chain configuration,
+// keyed by chain name. The gateways share the audit log.
+func NewGateways(cfg *config.Config) (map[string]*Gateway, error) {
+	auditLog, err := audit.Open(cfg.AuditLog)
+	if err != nil {
+		return nil, err
+	}
+	gateways := make(map[string]*Gateway, len(cfg.Chains))
+	for _, chain := range cfg.Chains {
+		log.Printf("⛓️ Initializing chain %s", chain.Name)
+		gw, err := newGateway(chain.Name, chain.Config, auditLog)
+		if err != nil {
+			auditLog.Close()
+			return nil, fmt.Errorf("chain %s: %w", chain.Name, err)
+		}
+		gateways[chain.Name] = gw
+	}
+	return gateways, nil
+}
+
+// ChainRouter serves each request with the proxy handler of the chain it
+// addresses, by Host header and path prefix, removing the prefix from the
+// path. A chain matching by host wins over one matching by path alone, and
+// a longer prefix over a shorter one. Requests matching no chain get a 404.
+func ChainRouter(chains []config.ChainConfig, gateways map[string]*Gateway) http.Handler {
+	handlers := make(map[string]http.Handler, len(chains))
+	for _, chain := range chains {
+		handlers[chain.Name] = gateways[chain.Name].ProxyHandler()
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		chain, ok := matchChain(chains, r)
+		if !ok {
+			logging.Limitedf("🧭 No chain for %s%s", r.Host, r.URL.Path)
+			gateways[chains[0].Name].writeError(w, r, http.StatusNotFound, rpcCodeInvalidRequest, "no chain configured for this host and path")
+			return
+		}
+		if chain.PathPrefix != "" {
+			r = stripPathPrefix(r, chain.PathPrefix)
+		}
+		handlers[chain.Name].ServeHTTP(w, r)
+	})
+}
+
+// matchChain returns the most specific chain the request addresses.
+func matchChain(chains []config.ChainConfig, r *http.Request) (config.ChainConfig, bool) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	var best config.ChainConfig
+	bestScore := -1
+	for _, chain := range chains {
+		if chain.Host != "" && !strings.EqualFold(chain.Host, host) {
+			continue
+		}
+		if chain.PathPrefix != "" && r.URL.Path != chain.PathPrefix && !strings.HasPrefix(r.URL.Path, chain.PathPrefix+"/") {
+			continue
+		}
+		score := len(chain.PathPrefix)
+		if chain.Host != "" {
+			score += 1 << 16
+		}
+		if score > bestScore {
+			best, bestScore = chain, score
+		}
+	}
+	return best, bestScore >= 0
+}
+
+// stripPathPrefix returns a shallow copy of r with prefix removed from its
+// path, leaving at least "/".
+func stripPathPrefix(r *http.Request, prefix string) *http.Request {
+	r2 := new(http.Request)
+	*r2 = *r
+	r2.URL = new(url.URL)
+	*r2.URL = *r.URL
+	r2.URL.Path = strings.TrimPrefix(r.URL.Path, prefix)
+	if r2.URL.Path == "" {
+		r2.URL.Path = "/"
+	}
+	r2.URL.RawPath = ""
+	return r2
+}
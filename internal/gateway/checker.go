@@ -4,146 +4,462 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"log"
 	"math/big"
 	"net/http"
+	"rpc-load-balancer/internal/config"
+	"rpc-load-balancer/internal/logging"
 	"rpc-load-balancer/internal/metrics"
+	"rpc-load-balancer/internal/tracing"
 	"rpc-load-balancer/internal/types"
+	"slices"
 	"sort"
-	"sync"
+	"strings"
 	"time"
 )
 
-// CheckEndpointStatus performs a health check.
-func (gw *Gateway) CheckEndpointStatus(ep *types.RpcEndpoint) {
-	ep.Mutex.Lock()
-	defer ep.Mutex.Unlock()
+// syncingMethod reports whether a node is still syncing; see Config.SyncCheck.
+const syncingMethod = "eth_syncing"
 
+// probeResult is the outcome of a single health-check call.
+type probeResult struct {
+	method     string
+	resultType string // config.HealthCheckResultHexBlock when the result sets BlockNumber
+	result     json.RawMessage
+	latency    time.Duration
+	status     int // HTTP status, 0 if no response was received
+	header     http.Header
+	reason     string // RpcCheckErrorsTotal reason, empty on success
+	message    string // Log message describing the failure
+}
+
+// CheckEndpointStatus performs a health check by calling every configured
+// health-check method. The endpoint is healthy when enough of them succeed.
+// The endpoint lock is not held while waiting on the network.
+func (gw *Gateway) CheckEndpointStatus(ctx context.Context, ep *types.RpcEndpoint) {
 	endpointURL := ep.URL.String() // Get URL for labels
+	_, span := tracing.Tracer.Start(ctx, "health_check")
+	defer endCheckSpan(span, ep) // Runs last, once the lock is released
 
 	now := time.Now()
+	ep.Mutex.Lock()
 	if ep.IsRateLimited && now.Before(ep.RateLimitedUntil) {
 		ep.IsReachable = false
 		metrics.RpcEndpointIsActive.WithLabelValues(endpointURL).Set(0)
+		ep.Mutex.Unlock()
 		return
 	}
 	if ep.IsRateLimited && now.After(ep.RateLimitedUntil) {
 		log.Printf("Retrying %s (Backoff Ended)", endpointURL)
 		ep.IsRateLimited = false
 	}
-
-	startTime := time.Now()
-	reqPayload := types.EthBlockNumberRequest{Jsonrpc: "2.0", Method: "eth_blockNumber", Params: []interface{}{}, ID: 1}
-	payloadBytes, _ := json.Marshal(reqPayload)
-	req, err := http.NewRequest("POST", endpointURL, bytes.NewBuffer(payloadBytes))
-	if err != nil {
-		log.Printf("Error creating request for %s: %v", endpointURL, err)
+	if gw.skipCredentialCheck(ep, now) {
 		ep.IsReachable = false
-		metrics.RpcCheckErrorsTotal.WithLabelValues(endpointURL, "request_creation").Inc()
 		metrics.RpcEndpointIsActive.WithLabelValues(endpointURL).Set(0)
+		ep.Mutex.Unlock()
 		return
 	}
-	req.Header.Set("Content-Type", "application/json")
+	if gw.skipOpenCircuit(ep, now) {
+		ep.Mutex.Unlock()
+		return
+	}
+	ep.Mutex.Unlock()
 
-	resp, err := gw.client.Do(req)
-	latency := time.Since(startTime)
-	metrics.RpcCheckDuration.WithLabelValues(endpointURL).Observe(latency.Seconds()) // <-- Observe duration
+	var results []probeResult
+	required := gw.config.HealthCheckMinSuccess
+	if !rpcChecked(ep) {
+		results = []probeResult{gw.probeHTTP(ep)}
+		required = 1
+	} else {
+		for _, check := range gw.config.HealthCheckMethods {
+			res := gw.probe(ep, check)
+			results = append(results, res)
+			// A rate limit or credential error condemns the whole check
+			if res.status == http.StatusTooManyRequests || isCredentialError(res.status) {
+				break
+			}
+		}
+	}
+	var syncRes *probeResult
+	if last := results[len(results)-1]; gw.config.SyncCheck != config.SyncCheckOff && rpcChecked(ep) &&
+		last.status != http.StatusTooManyRequests && !isCredentialError(last.status) {
+		res := gw.probe(ep, config.HealthCheckMethod{Method: syncingMethod})
+		syncRes = &res
+	}
+	var txRes []probeResult
+	if last := results[len(results)-1]; gw.config.TxRouting.Enabled && rpcChecked(ep) &&
+		last.status != http.StatusTooManyRequests && !isCredentialError(last.status) {
+		txRes = gw.probeTxHealth(ep)
+	}
 
-	if err != nil {
-		log.Printf("Error checking %s: %v", endpointURL, err)
+	ep.Mutex.Lock()
+	defer ep.Mutex.Unlock()
+	defer gw.recordUptime(ep, now) // Runs before the unlock, once IsReachable is final
+	defer gw.settleCircuit(ep, now)
+	if logging.Structured() {
+		defer logCheckResult(ep, results)
+	}
+
+	if syncRes != nil {
+		gw.updateSyncStatus(ep, *syncRes)
+	}
+	if txRes != nil {
+		gw.updateTxStatus(ep, txRes)
+	}
+
+	primary := results[0]
+	metrics.RpcCheckDuration.WithLabelValues(endpointURL).Observe(primary.latency.Seconds()) // <-- Observe duration
+	if primary.status != 0 {
+		ep.Latency = primary.latency
+		ep.LatencyEWMA = smoothLatency(ep.LatencyEWMA, primary.latency, gw.config.LatencyEWMAAlpha)
+		metrics.RpcEndpointLatency.WithLabelValues(endpointURL).Set(primary.latency.Seconds()) // <-- Set latency gauge
+		metrics.RpcEndpointLatencyEWMA.WithLabelValues(endpointURL).Set(ep.LatencyEWMA.Seconds())
+	}
+
+	successes := 0
+	for _, res := range results {
+		if res.header != nil {
+			updateQuota(ep, res.header)
+		}
+
+		if res.status == http.StatusTooManyRequests {
+			backoff := gw.markRateLimited(ep, now)
+			log.Printf("🚦 Rate limit detected for %s, backing off for %v", endpointURL, backoff.Round(time.Second))
+			ep.IsReachable = false
+			metrics.RpcRateLimitsTotal.WithLabelValues(endpointURL, "check").Inc() // <-- Inc rate limit
+			metrics.RpcEndpointIsActive.WithLabelValues(endpointURL).Set(0)
+			return
+		}
+
+		if isCredentialError(res.status) {
+			gw.markCredentialError(ep, res.status)
+			metrics.RpcCheckErrorsTotal.WithLabelValues(endpointURL, "credential_error").Inc()
+			return
+		}
+
+		if res.reason == "" && res.resultType == config.HealthCheckResultHexBlock {
+			blockNumber, err := parseQuantity(res.result)
+			if err != nil {
+				res.reason = "block_parse"
+				res.message = fmt.Sprintf("Error parsing block number %s from %s", res.result, endpointURL)
+			} else {
+				advanced := blockNumber > ep.BlockNumber || ep.BlockAdvancedAt.IsZero()
+				ep.BlockNumber = blockNumber
+				if advanced {
+					ep.BlockAdvancedAt = now
+					gw.clearBlockStale(ep)
+				}
+				metrics.RpcEndpointBlockNumber.WithLabelValues(endpointURL).Set(float64(ep.BlockNumber)) // <-- Set block gauge
+			}
+		}
+
+		if res.reason != "" {
+			logging.Limitedf("%s", res.message)
+			metrics.RpcCheckErrorsTotal.WithLabelValues(endpointURL, res.reason).Inc()
+			continue
+		}
+		successes++
+	}
+
+	if required <= 0 || required > len(gw.config.HealthCheckMethods) {
+		required = len(gw.config.HealthCheckMethods)
+	}
+	if successes < required {
 		ep.IsReachable = false
-		metrics.RpcCheckErrorsTotal.WithLabelValues(endpointURL, "http_do").Inc()
+		gw.recordOutcome(ep, true)
 		metrics.RpcEndpointIsActive.WithLabelValues(endpointURL).Set(0)
 		return
 	}
-	defer resp.Body.Close()
 
-	ep.Latency = latency
-	metrics.RpcEndpointLatency.WithLabelValues(endpointURL).Set(latency.Seconds()) // <-- Set latency gauge
+	ep.IsReachable = true
+	ep.RateLimitStreak = 0
+	gw.recordOutcome(ep, false)
+	if gw.config.MaxErrorRate > 0 && ep.RpcErrorDemoted {
+		// A demoted endpoint gets little traffic to prove itself with, so
+		// passed checks count towards lifting the demotion. Otherwise only
+		// proxied replies count, or checks would dilute the error rate
+		gw.recordRpcOutcome(ep, false)
+	}
+	clearCredentialError(ep)
+	metrics.RpcEndpointIsActive.WithLabelValues(endpointURL).Set(1) // <-- Set active gauge
+}
 
-	if resp.StatusCode == http.StatusTooManyRequests {
-		log.Printf("🚦 Rate limit detected for %s", endpointURL)
-		ep.IsRateLimited = true
-		ep.RateLimitedUntil = now.Add(gw.config.RateLimitBackoff)
-		ep.IsReachable = false
-		metrics.RpcRateLimitsTotal.WithLabelValues(endpointURL, "check").Inc() // <-- Inc rate limit
-		metrics.RpcEndpointIsActive.WithLabelValues(endpointURL).Set(0)
+// logCheckResult logs the outcome of a health check as a structured event.
+// The caller must hold the lock.
+func logCheckResult(ep *types.RpcEndpoint, results []probeResult) {
+	failures := []string{}
+	for _, res := range results {
+		if res.reason != "" {
+			failures = append(failures, res.method+": "+res.reason)
+		}
+	}
+	logging.Logger.Info("health_check", "endpoint", ep.URL.String(), "healthy", ep.IsReachable,
+		"block_number", ep.BlockNumber, "latency_ms", float64(ep.Latency.Microseconds())/1000,
+		"syncing", ep.IsSyncing, "rate_limited", ep.IsRateLimited, "credential_error", ep.HasCredentialError,
+		"errors", failures)
+}
+
+// updateSyncStatus records the outcome of an eth_syncing probe. A failed
+// probe leaves the previous status in place. The caller must hold the lock.
+func (gw *Gateway) updateSyncStatus(ep *types.RpcEndpoint, res probeResult) {
+	endpointURL := ep.URL.String()
+	if res.reason != "" {
+		logging.Limitedf("%s", res.message)
+		metrics.RpcCheckErrorsTotal.WithLabelValues(endpointURL, "sync_"+res.reason).Inc()
 		return
 	}
 
+	// Synced nodes answer false, syncing ones an object with progress details
+	syncing := strings.TrimSpace(string(res.result)) != "false"
+	if syncing != ep.IsSyncing {
+		if syncing {
+			log.Printf("🔄 %s reports it is syncing: %s", endpointURL, res.result)
+		} else {
+			log.Printf("✅ %s finished syncing", endpointURL)
+		}
+	}
+	ep.IsSyncing = syncing
+	if syncing {
+		metrics.RpcEndpointIsSyncing.WithLabelValues(endpointURL).Set(1)
+	} else {
+		metrics.RpcEndpointIsSyncing.WithLabelValues(endpointURL).Set(0)
+	}
+}
+
+// excludedBySync reports whether an endpoint must be kept out of selection
+// for its sync state: syncing under syncCheck enforce, or stuck at a stale
+// height. The caller must hold the read lock.
+func (gw *Gateway) excludedBySync(ep *types.RpcEndpoint) bool {
+	return ep.IsSyncing && gw.config.SyncCheck == config.SyncCheckEnforce || ep.BlockStale
+}
+
+// probe sends one health-check call to the endpoint and classifies the outcome.
+func (gw *Gateway) probe(ep *types.RpcEndpoint, check config.HealthCheckMethod) probeResult {
+	endpointURL := ep.URL.String()
+	res := probeResult{method: check.Method, resultType: check.ResultType}
+
+	params := check.Params
+	if params == nil {
+		params = []any{}
+	}
+	paramsBytes, _ := json.Marshal(params)
+	reqPayload := types.JsonRpcRequest{Jsonrpc: "2.0", Method: check.Method, Params: paramsBytes, ID: json.RawMessage("1")}
+	payloadBytes, _ := json.Marshal(reqPayload)
+
+	chargeCalls(ep, 1)
+	startTime := time.Now()
+	req, err := http.NewRequest("POST", endpointURL, bytes.NewBuffer(payloadBytes))
+	if err != nil {
+		res.reason = "request_creation"
+		res.message = fmt.Sprintf("Error creating request for %s: %v", endpointURL, err)
+		return res
+	}
+	req.Header.Set("Content-Type", "application/json")
+	setEndpointHeaders(req.Header, ep)
+
+	resp, err := gw.clientFor(ep).Do(req)
+	res.latency = time.Since(startTime)
+	if err != nil {
+		res.reason = timeoutReason(err)
+		res.message = fmt.Sprintf("Error checking %s: %v", endpointURL, err)
+		return res
+	}
+	defer resp.Body.Close()
+
+	res.status = resp.StatusCode
+	res.header = resp.Header
 	if resp.StatusCode != http.StatusOK {
-		log.Printf("HTTP Error %d from %s", resp.StatusCode, endpointURL)
-		ep.IsReachable = false
-		metrics.RpcCheckErrorsTotal.WithLabelValues(endpointURL, "http_status").Inc()
-		metrics.RpcEndpointIsActive.WithLabelValues(endpointURL).Set(0)
-		return
+		res.reason = "http_status"
+		res.message = fmt.Sprintf("HTTP Error %d from %s", resp.StatusCode, endpointURL)
+		return res
 	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		log.Printf("Error reading response from %s: %v", endpointURL, err)
-		ep.IsReachable = false
-		metrics.RpcCheckErrorsTotal.WithLabelValues(endpointURL, "read_body").Inc()
-		metrics.RpcEndpointIsActive.WithLabelValues(endpointURL).Set(0)
-		return
+		res.reason = "read_body"
+		res.message = fmt.Sprintf("Error reading response from %s: %v", endpointURL, err)
+		return res
 	}
 
-	var rpcResp types.EthBlockNumberResponse
+	var rpcResp types.JsonRpcResponse
 	if err := json.Unmarshal(body, &rpcResp); err != nil {
-		log.Printf("Error parsing JSON from %s: %v", endpointURL, err)
-		ep.IsReachable = false
-		metrics.RpcCheckErrorsTotal.WithLabelValues(endpointURL, "json_parse").Inc()
-		metrics.RpcEndpointIsActive.WithLabelValues(endpointURL).Set(0)
-		return
+		res.reason = "json_parse"
+		res.message = fmt.Sprintf("Error parsing JSON from %s: %v", endpointURL, err)
+		return res
 	}
 
 	if rpcResp.Error != nil {
-		log.Printf("RPC Error from %s: %s (%d)", endpointURL, rpcResp.Error.Message, rpcResp.Error.Code)
-		ep.IsReachable = false
-		metrics.RpcCheckErrorsTotal.WithLabelValues(endpointURL, "rpc_error").Inc()
-		metrics.RpcEndpointIsActive.WithLabelValues(endpointURL).Set(0)
-		return
+		res.reason = "rpc_error"
+		res.message = fmt.Sprintf("RPC Error from %s (%s): %s (%d)", endpointURL, check.Method, rpcResp.Error.Message, rpcResp.Error.Code)
+		return res
 	}
 
-	blockNumBig := new(big.Int)
-	_, success := blockNumBig.SetString(rpcResp.Result, 0)
-	if !success {
-		log.Printf("Error parsing block number '%s' from %s", rpcResp.Result, endpointURL)
-		ep.IsReachable = false
-		metrics.RpcCheckErrorsTotal.WithLabelValues(endpointURL, "block_parse").Inc()
-		metrics.RpcEndpointIsActive.WithLabelValues(endpointURL).Set(0)
-		return
+	res.result = rpcResp.Result
+	return res
+}
+
+// probeHTTP sends the endpoint's plain HTTP health check. Any 2xx status
+// counts as success.
+func (gw *Gateway) probeHTTP(ep *types.RpcEndpoint) probeResult {
+	check := ep.Config.HealthCheck
+	res := probeResult{method: check.HTTPMethod}
+	chargeCalls(ep, 1)
+
+	startTime := time.Now()
+	req, err := http.NewRequest(check.HTTPMethod, check.URL, nil)
+	if err != nil {
+		res.reason = "request_creation"
+		res.message = fmt.Sprintf("Error creating request for %s: %v", check.URL, err)
+		return res
 	}
+	setEndpointHeaders(req.Header, ep)
 
-	ep.BlockNumber = blockNumBig.Int64()
-	ep.IsReachable = true
-	metrics.RpcEndpointBlockNumber.WithLabelValues(endpointURL).Set(float64(ep.BlockNumber)) // <-- Set block gauge
-	metrics.RpcEndpointIsActive.WithLabelValues(endpointURL).Set(1)                          // <-- Set active gauge
+	resp, err := gw.clientFor(ep).Do(req)
+	res.latency = time.Since(startTime)
+	if err != nil {
+		res.reason = timeoutReason(err)
+		res.message = fmt.Sprintf("Error checking %s: %v", check.URL, err)
+		return res
+	}
+	io.Copy(io.Discard, resp.Body) // Drain so the connection can be reused
+	resp.Body.Close()
+
+	res.status = resp.StatusCode
+	res.header = resp.Header
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		res.reason = "http_status"
+		res.message = fmt.Sprintf("HTTP Error %d from %s", resp.StatusCode, check.URL)
+	}
+	return res
 }
 
-// SelectBestEndpoint uses gw.config.BlockTolerance.
+// rpcChecked reports whether the endpoint is health-checked with JSON-RPC
+// calls rather than a plain HTTP request.
+func rpcChecked(ep *types.RpcEndpoint) bool {
+	return ep.Config.HealthCheck.Type != config.HealthCheckHTTP
+}
+
+// tracksBlocks reports whether the endpoint's health check learns its block
+// number. Endpoints with a plain HTTP check, or checked with liveness-only
+// methods, are exempt from block tolerance.
+func (gw *Gateway) tracksBlocks(ep *types.RpcEndpoint) bool {
+	return rpcChecked(ep) && gw.config.HealthCheckTracksBlocks
+}
+
+// parseQuantity parses a JSON-RPC quantity such as an eth_blockNumber result.
+// Besides the standard 0x-prefixed hex string it accepts the decimal strings
+// and plain JSON numbers some nonstandard nodes return.
+func parseQuantity(result json.RawMessage) (int64, error) {
+	var raw string
+	if err := json.Unmarshal(result, &raw); err != nil {
+		var number json.Number
+		if json.Unmarshal(result, &number) != nil {
+			return 0, fmt.Errorf("invalid quantity %s", result)
+		}
+		raw = number.String()
+	}
+	base := 10
+	digits := raw
+	if len(raw) > 2 && (raw[:2] == "0x" || raw[:2] == "0X") {
+		base, digits = 16, raw[2:]
+	}
+	quantity := new(big.Int)
+	if _, ok := quantity.SetString(digits, base); !ok || !quantity.IsInt64() || quantity.Sign() < 0 {
+		return 0, fmt.Errorf("invalid quantity %q", raw)
+	}
+	return quantity.Int64(), nil
+}
+
+// SelectBestEndpoint checks every endpoint concurrently and selects the best
+// one, using gw.config.BlockTolerance. With early selection configured it
+// chooses among the endpoints checked so far once the quorum or budget is
+// reached and refines the choice as the remaining checks complete.
 func (gw *Gateway) SelectBestEndpoint() {
 	log.Println("\n🔍 Checking for the best RPC endpoint...")
-	var wg sync.WaitGroup
+	endpoints := gw.endpoints()
+	if len(endpoints) == 0 {
+		log.Println("⚠️ No endpoints configured. Nothing to select.")
+		gw.setRanking(nil)
+		return
+	}
+
+	ctx, span := tracing.Tracer.Start(context.Background(), "selection")
+	defer span.End()
 
-	for _, ep := range gw.Endpoints {
-		wg.Add(1)
+	start := time.Now()
+	done := make(chan *types.RpcEndpoint, len(endpoints))
+	for _, ep := range endpoints {
 		go func(endpoint *types.RpcEndpoint) {
-			defer wg.Done()
-			gw.CheckEndpointStatus(endpoint)
+			gw.CheckEndpointStatus(ctx, endpoint)
+			done <- endpoint
 		}(ep)
 	}
-	wg.Wait()
 
+	cfg := gw.config.Selection
+	early := cfg.Mode == config.SelectionEarly
+	var budget <-chan time.Time
+	if early && cfg.Budget > 0 {
+		timer := time.NewTimer(cfg.Budget)
+		defer timer.Stop()
+		budget = timer.C
+	}
+
+	checked := make(map[*types.RpcEndpoint]bool, len(endpoints))
+	ready, selected := false, false
+	for len(checked) < len(endpoints) {
+		select {
+		case ep := <-done:
+			checked[ep] = true
+		case <-budget:
+			budget = nil
+			ready = true
+		}
+		if !early || len(checked) == len(endpoints) {
+			continue
+		}
+		ready = ready || (cfg.Quorum > 0 && len(checked) >= cfg.Quorum)
+		if ready && gw.selectAmong(checked, true) && !selected {
+			selected = true
+			gw.observeSelection(start, len(checked), len(endpoints))
+		}
+	}
+
+	gw.updateHealthScores()
+	if gw.selectAmong(checked, false) && !selected {
+		gw.observeSelection(start, len(checked), len(endpoints))
+	}
+}
+
+// observeSelection records how complete and how fast a selection pass was
+// when it first chose a best endpoint.
+func (gw *Gateway) observeSelection(start time.Time, checked, total int) {
+	metrics.RpcSelectionCompleteness.WithLabelValues(gw.chain).Set(float64(checked) / float64(total))
+	metrics.RpcSelectionDuration.WithLabelValues(gw.chain).Observe(time.Since(start).Seconds())
+}
+
+// selectAmong selects the best endpoint among the checked ones and reports
+// whether one was found. Partial passes, made before every check completed,
+// only log changes of the best endpoint and leave it alone when nothing
+// qualifies yet.
+func (gw *Gateway) selectAmong(checked map[*types.RpcEndpoint]bool, partial bool) bool {
 	var candidates []*types.RpcEndpoint
 	var highestBlock int64 = -1
 
-	for _, ep := range gw.Endpoints {
+	set := gw.endpointSet.Load()
+	if !partial && gw.config.MaxBlockStaleness > 0 {
+		gw.updateBlockStaleness(set.all)
+	}
+	for _, ep := range set.all {
+		// The canary only receives its configured share of traffic
+		if !checked[ep] || ep == set.canary {
+			continue
+		}
 		ep.Mutex.RLock()
-		if ep.IsReachable && !ep.IsRateLimited {
+		if ep.IsReachable && !ep.IsRateLimited && !gw.excludedBySync(ep) {
 			candidates = append(candidates, ep)
-			if ep.BlockNumber > highestBlock {
+			if gw.tracksBlocks(ep) && ep.BlockNumber > highestBlock {
 				highestBlock = ep.BlockNumber
 			}
 		}
@@ -151,96 +467,182 @@ func (gw *Gateway) SelectBestEndpoint() {
 	}
 
 	if len(candidates) == 0 {
-		log.Println("⚠️ No reachable, non-rate-limited endpoints found. Keeping current best.")
-		for _, ep := range gw.Endpoints {
+		if partial {
+			return false
+		}
+		log.Println("⚠️ No reachable, non-rate-limited, synced endpoints found. Keeping current best.")
+		gw.noHealthy.Store(true)
+		metrics.RpcHealthyEndpoints.WithLabelValues(gw.chain).Set(0)
+		metrics.RpcNoEndpointsTotal.WithLabelValues(gw.chain).Inc()
+		setCurrentBestInfo(gw.GetBestEndpoint(), nil)
+		for _, ep := range set.all {
 			metrics.RpcEndpointIsCurrentBest.WithLabelValues(ep.URL.String()).Set(metrics.RpcEndpointCurrentBestNotActive)
-			// Check verbose before logging
-			if gw.config.Verbose {
-				log.Printf("📊 METRIC: RpcEndpointIsCurrentBest{endpoint=\"%s\"} set to %v (No candidates)", ep.URL.String(), metrics.RpcEndpointCurrentBestNotActive)
-			}
+			logCurrentBestMetric(ep.URL.String(), metrics.RpcEndpointCurrentBestNotActive, "no candidates")
 		}
-		return
+		return false
 	}
 
+	wasValidated := gw.validated.Swap(true)
+
+	if gw.config.BlockQuorum > 1 {
+		candidates, highestBlock = gw.applyBlockQuorum(candidates, highestBlock, partial)
+	}
+	gw.noHealthy.Store(false)
+	if !partial {
+		metrics.RpcHealthyEndpoints.WithLabelValues(gw.chain).Set(float64(len(candidates)))
+	}
+	if !partial && len(candidates) < gw.config.MinCandidates {
+		// A best validated by an earlier pass is kept while it is still a
+		// candidate; the unchecked endpoint in place at startup is not.
+		// Partial passes see only part of the pool and are not judged.
+		currentBest := gw.GetBestEndpoint()
+		keep := gw.config.DegradedSelection == config.DegradedSelectionKeep && wasValidated &&
+			slices.Contains(candidates, currentBest)
+		log.Printf("⚠️ Degraded selection: %d of %d endpoints healthy, fewer than minCandidates (%d)", len(candidates), len(set.all), gw.config.MinCandidates)
+		metrics.RpcDegradedSelectionTotal.WithLabelValues(gw.chain).Inc()
+		if keep {
+			log.Printf("⚠️ Keeping current best %s until enough endpoints are healthy.", endpointLabel(currentBest))
+			return true
+		}
+	}
 	blockThreshold := highestBlock - gw.config.BlockTolerance // Use config
-	log.Printf("📈 Highest block found: %d. Threshold: >= %d", highestBlock, blockThreshold)
+	if !partial {
+		log.Printf("📈 Highest block found: %d. Threshold: >= %d", highestBlock, blockThreshold)
+	}
 
 	var finalCandidates []*types.RpcEndpoint
 	for _, ep := range candidates {
 		ep.Mutex.RLock()
-		if ep.BlockNumber >= blockThreshold {
+		if ep.BlockNumber >= blockThreshold || !gw.tracksBlocks(ep) {
 			finalCandidates = append(finalCandidates, ep)
 		}
 		ep.Mutex.RUnlock()
 	}
 
 	if len(finalCandidates) == 0 {
-		log.Println("🟡 No endpoints within block tolerance. Considering all reachable.")
+		if !partial {
+			log.Println("🟡 No endpoints within block tolerance. Considering all reachable.")
+		}
 		finalCandidates = candidates
 	}
 
-	sort.Slice(finalCandidates, func(i, j int) bool {
+	// A stable sort keeps config order among tied endpoints, so the best
+	// does not flip arbitrarily between equivalent candidates.
+	sort.SliceStable(finalCandidates, func(i, j int) bool {
 		finalCandidates[i].Mutex.RLock()
 		finalCandidates[j].Mutex.RLock()
 		defer finalCandidates[i].Mutex.RUnlock()
 		defer finalCandidates[j].Mutex.RUnlock()
-		return finalCandidates[i].Latency < finalCandidates[j].Latency
+		return gw.candidateLess(finalCandidates[i], finalCandidates[j])
 	})
 
 	best := finalCandidates[0]
+	if held := gw.dwellHold(best, finalCandidates); held != nil {
+		if !partial {
+			log.Printf("⏳ Keeping %s for its minimum dwell time over %s", held.URL.String(), best.URL.String())
+			metrics.RpcDwellHoldsTotal.WithLabelValues(gw.chain).Inc()
+		}
+		best = held
+	}
+	gw.updatePool(best, finalCandidates)
+	ranking := make([]*types.RpcEndpoint, 0, len(finalCandidates))
+	ranking = append(ranking, best)
+	for _, ep := range finalCandidates {
+		if ep != best {
+			ranking = append(ranking, ep)
+		}
+	}
 	best.Mutex.RLock()
-	currentBestURL := gw.GetBestEndpoint().URL.String()
+	currentBest := gw.GetBestEndpoint()
+	currentBestURL := endpointLabel(currentBest)
 	bestURL := best.URL.String()
 	bestBlock := best.BlockNumber
-	bestLatency := best.Latency
+	bestLatency := best.LatencyEWMA
+	bestRegion := best.Config.Region
 	best.Mutex.RUnlock()
 
+	gw.setServingRegion(bestRegion)
+	gw.setRanking(ranking)
+
+	if !partial && best == currentBest && best == finalCandidates[0] && gw.config.IncumbentDiscount > 0 && len(finalCandidates) > 1 && gw.lessUnbiased(finalCandidates[1], best) {
+		metrics.RpcIncumbentRetainedTotal.WithLabelValues(gw.chain).Inc()
+	}
+
 	if currentBestURL != bestURL {
 		log.Printf("✅ New best endpoint: %s (Block: %d, Latency: %v)", bestURL, bestBlock, bestLatency)
-		gw.setBestEndpoint(best)
+		metrics.RpcBestEndpointChangesTotal.WithLabelValues(bestURL).Inc()
+		gw.audit.Selection(currentBestURL, bestURL, bestBlock, bestLatency)
 		// Update metrics: Set old best to 0, new best to 1
-		metrics.RpcEndpointIsCurrentBest.WithLabelValues(currentBestURL).Set(metrics.RpcEndpointCurrentBestNotActive)
-		if gw.config.Verbose { // <-- Check verbose
-			log.Printf("📊 METRIC: RpcEndpointIsCurrentBest{endpoint=\"%s\"} set to %v", currentBestURL, metrics.RpcEndpointCurrentBestNotActive)
+		if currentBest != nil {
+			metrics.RpcEndpointIsCurrentBest.WithLabelValues(currentBestURL).Set(metrics.RpcEndpointCurrentBestNotActive)
+			logCurrentBestMetric(currentBestURL, metrics.RpcEndpointCurrentBestNotActive, "demoted")
 		}
 
 		metrics.RpcEndpointIsCurrentBest.WithLabelValues(bestURL).Set(metrics.RpcEndpointCurrentBestActive)
-		if gw.config.Verbose { // <-- Check verbose
-			log.Printf("📊 METRIC: RpcEndpointIsCurrentBest{endpoint=\"%s\"} set to %v", bestURL, metrics.RpcEndpointCurrentBestActive)
-		}
+		logCurrentBestMetric(bestURL, metrics.RpcEndpointCurrentBestActive, "promoted")
+		setCurrentBestInfo(currentBest, best)
 	} else {
-		log.Printf("👍 Best endpoint remains: %s (Block: %d, Latency: %v)", bestURL, bestBlock, bestLatency)
+		if !partial {
+			log.Printf("👍 Best endpoint remains: %s (Block: %d, Latency: %v)", bestURL, bestBlock, bestLatency)
+		}
 		// Ensure it's set to 1
 		metrics.RpcEndpointIsCurrentBest.WithLabelValues(bestURL).Set(metrics.RpcEndpointCurrentBestActive)
-		if gw.config.Verbose { // <-- Check verbose
-			log.Printf("📊 METRIC: RpcEndpointIsCurrentBest{endpoint=\"%s\"} set to %v (reaffirmed)", bestURL, metrics.RpcEndpointCurrentBestActive)
-		}
+		logCurrentBestMetric(bestURL, metrics.RpcEndpointCurrentBestActive, "reaffirmed")
+		setCurrentBestInfo(nil, best)
 	}
 
 	// Ensure all *other* endpoints are set to 0
-	for _, ep := range gw.Endpoints {
+	for _, ep := range set.all {
 		epURL := ep.URL.String()
 		if epURL != bestURL {
 			metrics.RpcEndpointIsCurrentBest.WithLabelValues(epURL).Set(metrics.RpcEndpointCurrentBestNotActive)
-			if gw.config.Verbose { // <-- Check verbose
-				log.Printf("📊 METRIC: RpcEndpointIsCurrentBest{endpoint=\"%s\"} set to %v (not best)", epURL, metrics.RpcEndpointCurrentBestNotActive)
-			}
+			logCurrentBestMetric(epURL, metrics.RpcEndpointCurrentBestNotActive, "not best")
 		}
 	}
+	return true
+}
 
+// logCurrentBestMetric logs an RpcEndpointIsCurrentBest update in verbose mode.
+func logCurrentBestMetric(endpointURL string, value float64, reason string) {
+	if !logging.DebugEnabled() {
+		return
+	}
+	logging.Logger.Debug("📊 METRIC: RpcEndpointIsCurrentBest", "endpoint", endpointURL, "value", value, "reason", reason)
+}
+
+// setCurrentBestInfo moves the rpc_gateway_current_best_info series from the
+// previous best to the new one. Either may be nil: without a previous best
+// the series is only set, without a new one it is only removed.
+func setCurrentBestInfo(previous, best *types.RpcEndpoint) {
+	if previous != nil && previous != best {
+		metrics.RpcCurrentBestInfo.DeleteLabelValues(previous.URL.String())
+	}
+	if best != nil {
+		metrics.RpcCurrentBestInfo.WithLabelValues(best.URL.String()).Set(1)
+	}
 }
 
 // StartChecker uses gw.config.CheckInterval.
 func (gw *Gateway) StartChecker(ctx context.Context) {
 	gw.SelectBestEndpoint()
-	ticker := time.NewTicker(gw.config.CheckInterval) // Use config
+	interval := gw.config.CheckInterval
+	ticker := time.NewTicker(interval) // Use config
+	ctx, gw.stopChecker = context.WithCancel(ctx)
+	gw.checkerDone = make(chan struct{})
 
 	go func() {
+		defer close(gw.checkerDone)
 		defer ticker.Stop()
 		for {
 			select {
 			case <-ticker.C:
 				gw.SelectBestEndpoint()
+			case reloaded := <-gw.reloadInterval:
+				if reloaded != interval {
+					interval = reloaded
+					ticker.Reset(interval)
+					log.Printf("Checker interval changed to %v.", interval)
+				}
 			case <-ctx.Done():
 				log.Println("Checker goroutine stopping.")
 				return
@@ -249,3 +651,18 @@ func (gw *Gateway) StartChecker(ctx context.Context) {
 	}()
 	log.Printf("Periodic endpoint checker started (Interval: %v).", gw.config.CheckInterval)
 }
+
+// StopChecker stops the health checker and waits until a selection pass in
+// progress has finished, or ctx ends.
+func (gw *Gateway) StopChecker(ctx context.Context) error {
+	if gw.stopChecker == nil {
+		return nil
+	}
+	gw.stopChecker()
+	select {
+	case <-gw.checkerDone:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("health checker still running: %w", ctx.Err())
+	}
+}
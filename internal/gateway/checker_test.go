@@ -0,0 +1,43 @@
+package gateway
+
+import (
+	"log"
+	"os"
+	"rpc-load-balancer/internal/logging"
+	"testing"
+)
+
+// dropWriter discards its input. Unlike io.Discard, the log package cannot
+// recognize it and skip formatting, so the cost of building messages shows.
+type dropWriter struct{}
+
+func (dropWriter) Write(p []byte) (int, error) { return len(p), nil }
+
+func BenchmarkSelectBestEndpoint(b *testing.B) {
+	var urls []string
+	for range 8 {
+		urls = append(urls, newTestUpstream(b, nil).URL)
+	}
+
+	for _, bm := range []struct {
+		name    string
+		verbose bool
+	}{
+		{name: "quiet", verbose: false},
+		{name: "verbose", verbose: true},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			log.SetOutput(dropWriter{})
+			logging.Setup(bm.verbose, false)
+			b.Cleanup(func() {
+				log.SetOutput(os.Stderr)
+				logging.Setup(false, false)
+			})
+			gw := newTestGateway(b, "", urls...)
+
+			for b.Loop() {
+				gw.SelectBestEndpoint()
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package gateway
+
+import (
+	"log"
+	"rpc-load-balancer/internal/metrics"
+	"rpc-load-balancer/internal/types"
+	"time"
+)
+
+// recordProxyOutcome records the outcome of a proxied request like
+// recordOutcome and drives the circuit breaker: after circuitBreakerThreshold
+// consecutive failures the endpoint's circuit opens. An open circuit marks
+// the endpoint unreachable and skips its health checks until
+// circuitBreakerCooldown has passed; the next health check is then the
+// half-open probe that closes or reopens it. The caller must hold the write
+// lock.
+func (gw *Gateway) recordProxyOutcome(ep *types.RpcEndpoint, failed bool) {
+	gw.recordOutcome(ep, failed)
+	threshold := gw.config.CircuitBreakerThreshold
+	if threshold <= 0 {
+		return
+	}
+	if !failed {
+		ep.ProxyFailures = 0
+		return
+	}
+	ep.ProxyFailures++
+	if ep.ProxyFailures < threshold || !ep.CircuitOpenUntil.IsZero() {
+		return
+	}
+	log.Printf("🔌 Circuit opened for %s after %d consecutive failed requests, retrying in %v", ep.URL, ep.ProxyFailures, gw.config.CircuitBreakerCooldown)
+	gw.openCircuit(ep, time.Now())
+	go gw.SelectBestEndpoint()
+}
+
+// openCircuit takes the endpoint out of rotation for circuitBreakerCooldown.
+// The caller must hold the write lock.
+func (gw *Gateway) openCircuit(ep *types.RpcEndpoint, now time.Time) {
+	endpointURL := ep.URL.String()
+	ep.CircuitOpenUntil = now.Add(gw.config.CircuitBreakerCooldown)
+	ep.IsReachable = false
+	metrics.RpcEndpointIsActive.WithLabelValues(endpointURL).Set(0)
+	metrics.RpcEndpointCircuitState.WithLabelValues(endpointURL).Set(metrics.CircuitOpen)
+}
+
+// skipOpenCircuit reports whether a health check starting at now must be
+// skipped because the endpoint's circuit is open. Once the cooldown has
+// passed the circuit turns half-open and the check goes ahead as the probe.
+// The caller must hold the write lock.
+func (gw *Gateway) skipOpenCircuit(ep *types.RpcEndpoint, now time.Time) bool {
+	if ep.CircuitOpenUntil.IsZero() {
+		return false
+	}
+	endpointURL := ep.URL.String()
+	if now.Before(ep.CircuitOpenUntil) {
+		ep.IsReachable = false
+		metrics.RpcEndpointIsActive.WithLabelValues(endpointURL).Set(0)
+		return true
+	}
+	metrics.RpcEndpointCircuitState.WithLabelValues(endpointURL).Set(metrics.CircuitHalfOpen)
+	return false
+}
+
+// settleCircuit closes a half-open circuit after a passed health check and
+// reopens it after a failed one. A check that started before the circuit
+// opened leaves the endpoint unreachable. The caller must hold the write
+// lock.
+func (gw *Gateway) settleCircuit(ep *types.RpcEndpoint, checkStart time.Time) {
+	if ep.CircuitOpenUntil.IsZero() {
+		return
+	}
+	endpointURL := ep.URL.String()
+	if checkStart.Before(ep.CircuitOpenUntil) {
+		ep.IsReachable = false
+		metrics.RpcEndpointIsActive.WithLabelValues(endpointURL).Set(0)
+		return
+	}
+	if !ep.IsReachable {
+		log.Printf("🔌 Circuit probe of %s failed, retrying in %v", endpointURL, gw.config.CircuitBreakerCooldown)
+		gw.openCircuit(ep, time.Now())
+		return
+	}
+	log.Printf("🔌 Circuit closed for %s", endpointURL)
+	ep.CircuitOpenUntil = time.Time{}
+	ep.ProxyFailures = 0
+	metrics.RpcEndpointCircuitState.WithLabelValues(endpointURL).Set(metrics.CircuitClosed)
+}
@@ -0,0 +1,50 @@
+package gateway
+
+import (
+	"net/netip"
+	"rpc-load-balancer/internal/config"
+	"rpc-load-balancer/internal/ratelimit"
+	"time"
+)
+
+// newClientLimiter creates the per-client-IP limiter, or returns nil when
+// clientRateLimit is disabled.
+func newClientLimiter(cfg config.ClientRateLimitConfig) *ratelimit.Limiter {
+	if cfg.RequestsPerSecond == 0 {
+		return nil
+	}
+	return ratelimit.New(cfg.RequestsPerSecond, cfg.Burst)
+}
+
+// clientRateLimited takes a token from the client's bucket. When the bucket
+// is empty it returns true and how long the client should wait, at least a
+// second. Allowlisted clients are never limited.
+func (gw *Gateway) clientRateLimited(clientIP string) (time.Duration, bool) {
+	if gw.clientLimiter == nil || gw.clientAllowlisted(clientIP) {
+		return 0, false
+	}
+	wait, ok := gw.clientLimiter.Take(clientIP)
+	if ok {
+		return 0, false
+	}
+	return max(wait, time.Second), true
+}
+
+// clientAllowlisted reports whether clientIP is in clientRateLimit.allowlist.
+func (gw *Gateway) clientAllowlisted(clientIP string) bool {
+	prefixes := gw.config.ClientRateLimit.AllowedPrefixes
+	if len(prefixes) == 0 {
+		return false
+	}
+	addr, err := netip.ParseAddr(clientIP)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
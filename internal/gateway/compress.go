@@ -0,0 +1,212 @@
+package gateway
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// compressor is the part of gzip.Writer and zlib.Writer the response
+// writer uses.
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// compressWriter compresses a response with the encoding the client
+// accepted. The decision is made when the status is written: responses that
+// cannot have a body, already carry a Content-Encoding or announce a
+// Content-Length below minBytes pass through unchanged. Without a
+// Content-Length the body is buffered until minBytes have been written, so
+// small responses of unknown length also pass through.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	minBytes int64
+	sent     int64 // Body bytes written to the client, after compression
+
+	status   int  // Held back while undecided
+	decided  bool // Whether the status went out
+	buffer   []byte
+	encoder  compressor // nil when passing through
+	finished bool
+}
+
+// newCompressWriter returns a compressing writer for a request whose client
+// accepts gzip or deflate, or nil when compression is disabled or the
+// client accepts neither.
+func (gw *Gateway) newCompressWriter(w http.ResponseWriter, r *http.Request) *compressWriter {
+	if !gw.config.Compression.Enabled || r.Method == http.MethodHead {
+		return nil
+	}
+	encoding := acceptedEncoding(r.Header.Get("Accept-Encoding"))
+	if encoding == "" {
+		return nil
+	}
+	return &compressWriter{ResponseWriter: w, encoding: encoding, minBytes: gw.config.Compression.MinBytes}
+}
+
+// acceptedEncoding returns "gzip" or "deflate" if the Accept-Encoding header
+// allows it, preferring gzip, or "" if it allows neither.
+func acceptedEncoding(header string) string {
+	accepted := make(map[string]bool)
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		q, hasQ := strings.CutPrefix(strings.ReplaceAll(params, " ", ""), "q=")
+		if hasQ {
+			if weight, err := strconv.ParseFloat(q, 64); err == nil && weight == 0 {
+				continue
+			}
+		}
+		accepted[name] = true
+	}
+	switch {
+	case accepted["gzip"]:
+		return "gzip"
+	case accepted["deflate"]:
+		return "deflate"
+	}
+	return ""
+}
+
+// WriteHeader decides whether the response is compressed. The status is
+// held back while the size of a body without Content-Length is unknown.
+// Informational statuses such as 103 Early Hints go out right away and
+// leave the decision to the final status.
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.decided || cw.status != 0 {
+		return
+	}
+	if status >= 100 && status < http.StatusOK && status != http.StatusSwitchingProtocols {
+		cw.ResponseWriter.WriteHeader(status)
+		return
+	}
+	header := cw.Header()
+	if status == http.StatusSwitchingProtocols || status == http.StatusNoContent || status == http.StatusNotModified ||
+		header.Get("Content-Encoding") != "" {
+		cw.pass(status)
+		return
+	}
+	if length, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64); err == nil {
+		if length < cw.minBytes {
+			cw.pass(status)
+		} else {
+			cw.compress(status)
+		}
+		return
+	}
+	cw.status = status
+}
+
+// Write compresses, buffers or passes through p depending on the decision.
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if !cw.decided && cw.status == 0 {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.decided {
+		if cw.encoder != nil {
+			return cw.encoder.Write(p)
+		}
+		return cw.writeSent(p)
+	}
+	cw.buffer = append(cw.buffer, p...)
+	if int64(len(cw.buffer)) >= cw.minBytes {
+		cw.compress(cw.status)
+		if err := cw.writeBuffer(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush sends what was written so far. The proxy flushes after every write
+// of a response without Content-Length, so an undecided response stays
+// buffered until minBytes decide it or Close sends it.
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		return
+	}
+	if cw.encoder != nil {
+		cw.encoder.Flush()
+	}
+	http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// Unwrap returns the original ResponseWriter, so http.ResponseController can
+// reach optional interfaces such as http.Hijacker.
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// Close sends a response still held back uncompressed, or completes the
+// compressed stream. It must be called once the handler is done.
+func (cw *compressWriter) Close() error {
+	if cw.finished {
+		return nil
+	}
+	cw.finished = true
+	if !cw.decided && cw.status != 0 {
+		cw.pass(cw.status)
+		return cw.writeBuffer()
+	}
+	if cw.encoder != nil {
+		return cw.encoder.Close()
+	}
+	return nil
+}
+
+// pass sends the status and leaves the body uncompressed.
+func (cw *compressWriter) pass(status int) {
+	cw.decided = true
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+// compress sends the status with the compression headers and starts the
+// encoder. net/http switches to chunked encoding as the length is unknown.
+func (cw *compressWriter) compress(status int) {
+	header := cw.Header()
+	header.Del("Content-Length")
+	header.Set("Content-Encoding", cw.encoding)
+	header.Add("Vary", "Accept-Encoding")
+	wire := writerFunc(cw.writeSent)
+	if cw.encoding == "gzip" {
+		cw.encoder = gzip.NewWriter(wire)
+	} else {
+		// HTTP deflate is the zlib format (RFC 9110), not raw DEFLATE
+		cw.encoder = zlib.NewWriter(wire)
+	}
+	cw.decided = true
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+// writeBuffer writes the body buffered while undecided.
+func (cw *compressWriter) writeBuffer() error {
+	buffer := cw.buffer
+	cw.buffer = nil
+	if len(buffer) == 0 {
+		return nil
+	}
+	var err error
+	if cw.encoder != nil {
+		_, err = cw.encoder.Write(buffer)
+	} else {
+		_, err = cw.writeSent(buffer)
+	}
+	return err
+}
+
+// writeSent writes p to the client and counts the bytes sent.
+func (cw *compressWriter) writeSent(p []byte) (int, error) {
+	n, err := cw.ResponseWriter.Write(p)
+	cw.sent += int64(n)
+	return n, err
+}
+
+// writerFunc adapts a function to io.Writer.
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
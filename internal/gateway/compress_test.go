@@ -0,0 +1,97 @@
+package gateway
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+func TestCompressWriterInformationalStatus(t *testing.T) {
+	const body = `{"jsonrpc":"2.0","id":1,"error":{"code":-32005,"message":"rate limited"}}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cw := &compressWriter{ResponseWriter: w, encoding: "gzip", minBytes: 1024}
+		cw.Header().Set("Link", "</style.css>; rel=preload")
+		cw.WriteHeader(http.StatusEarlyHints)
+		cw.Header().Set("Content-Type", "application/json")
+		cw.WriteHeader(http.StatusTooManyRequests)
+		io.WriteString(cw, body)
+		cw.Close()
+	}))
+	defer server.Close()
+
+	var informational []int
+	trace := &httptrace.ClientTrace{
+		Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+			informational = append(informational, code)
+			return nil
+		},
+	}
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	got, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(informational) != 1 || informational[0] != http.StatusEarlyHints {
+		t.Errorf("informational statuses = %v, want [%d]", informational, http.StatusEarlyHints)
+	}
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusTooManyRequests)
+	}
+	if strings.TrimSpace(string(got)) != body {
+		t.Errorf("body = %q, want %q", got, body)
+	}
+}
+
+func TestCompressWriterCountsSentBytes(t *testing.T) {
+	body := strings.Repeat(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`, 100)
+	sent := make(chan int64, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cw := &compressWriter{ResponseWriter: w, encoding: "gzip", minBytes: 1024}
+		io.WriteString(cw, body)
+		cw.Close()
+		sent <- cw.sent
+	}))
+	defer server.Close()
+
+	// Without automatic decompression the client reads the bytes on the wire
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	got, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", resp.Header.Get("Content-Encoding"))
+	}
+	n := <-sent
+	if n != int64(len(got)) {
+		t.Errorf("sent = %d, want the %d bytes received", n, len(got))
+	}
+	if n >= int64(len(body)) {
+		t.Errorf("sent = %d, want fewer than the %d uncompressed bytes", n, len(body))
+	}
+}
@@ -0,0 +1,59 @@
+package gateway
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// handleCORS adds the CORS headers for the request's origin and answers
+// preflight requests, reporting whether it did. It runs before any other
+// check, so that browsers can also read the gateway's own error responses.
+func (gw *Gateway) handleCORS(w http.ResponseWriter, r *http.Request) bool {
+	cors := gw.config.CORS
+	origin := r.Header.Get("Origin")
+	if len(cors.AllowedOrigins) == 0 || origin == "" {
+		return false
+	}
+	preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+	header := w.Header()
+	header.Add("Vary", "Origin")
+	if preflight {
+		header.Add("Vary", "Access-Control-Request-Method")
+		header.Add("Vary", "Access-Control-Request-Headers")
+	}
+	switch {
+	case slices.ContainsFunc(cors.AllowedOrigins, func(o string) bool { return strings.EqualFold(o, origin) }):
+		// A listed origin is echoed, as credentialed requests require
+		header.Set("Access-Control-Allow-Origin", origin)
+		if cors.AllowCredentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+	case slices.Contains(cors.AllowedOrigins, "*"):
+		header.Set("Access-Control-Allow-Origin", "*")
+	default:
+		if preflight {
+			w.WriteHeader(http.StatusForbidden)
+		}
+		return preflight
+	}
+
+	if !preflight {
+		return false
+	}
+	header.Set("Access-Control-Allow-Methods", strings.Join(cors.AllowedMethods, ", "))
+	header.Set("Access-Control-Allow-Headers", strings.Join(cors.AllowedHeaders, ", "))
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
+
+// stripCORSHeaders removes an upstream's own CORS headers from its response,
+// which would otherwise be added to the gateway's.
+func stripCORSHeaders(header http.Header) {
+	for name := range header {
+		if strings.HasPrefix(name, "Access-Control-") {
+			delete(header, name)
+		}
+	}
+}
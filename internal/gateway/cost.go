@@ -0,0 +1,43 @@
+package gateway
+
+import (
+	"rpc-load-balancer/internal/metrics"
+	"rpc-load-balancer/internal/types"
+)
+
+// maxCostPerRequest returns the highest costPerRequest of the endpoints.
+func maxCostPerRequest(endpoints []*types.RpcEndpoint) float64 {
+	highest := 0.0
+	for _, ep := range endpoints {
+		highest = max(highest, ep.Config.CostPerRequest)
+	}
+	return highest
+}
+
+// costFactor scales the endpoint's selection cost by its price relative to
+// the most expensive endpoint: with costWeight 1 the priciest endpoint counts
+// as twice as slow as a free one.
+func (gw *Gateway) costFactor(ep *types.RpcEndpoint) float64 {
+	maxCost := gw.endpointSet.Load().maxCost
+	if gw.config.CostWeight == 0 || maxCost == 0 {
+		return 1
+	}
+	return 1 + gw.config.CostWeight*ep.Config.CostPerRequest/maxCost
+}
+
+// chargeCalls adds the cost of sending calls JSON-RPC calls to the endpoint.
+func chargeCalls(ep *types.RpcEndpoint, calls int) {
+	if ep.Config.CostPerRequest == 0 {
+		return
+	}
+	metrics.RpcEndpointCostTotal.WithLabelValues(ep.URL.String()).Add(ep.Config.CostPerRequest * float64(calls))
+}
+
+// callCount returns the number of calls a request carries; requests that are
+// not JSON-RPC count as one.
+func (state *requestState) callCount() int {
+	if state.payload == nil {
+		return 1
+	}
+	return len(state.payload.Calls)
+}
@@ -0,0 +1,55 @@
+package gateway
+
+import (
+	"log"
+	"net/http"
+	"rpc-load-balancer/internal/config"
+	"rpc-load-balancer/internal/metrics"
+	"rpc-load-balancer/internal/types"
+	"time"
+)
+
+// isCredentialError reports whether an upstream status means the endpoint
+// rejected our credentials rather than failing transiently.
+func isCredentialError(status int) bool {
+	return status == http.StatusUnauthorized || status == http.StatusForbidden
+}
+
+// markCredentialError flags the endpoint as misconfigured and excludes it
+// from selection. The error is logged only when the endpoint is first
+// flagged. The caller must hold ep.Mutex for writing.
+func (gw *Gateway) markCredentialError(ep *types.RpcEndpoint, status int) {
+	endpointURL := ep.URL.String()
+	if !ep.HasCredentialError {
+		log.Printf("🔑 Credential error: %s answered HTTP %d. Check its API key; the endpoint is disabled.", endpointURL, status)
+	}
+	ep.HasCredentialError = true
+	ep.CredentialRetryAt = time.Now().Add(gw.config.CredentialErrorBackoff)
+	ep.IsReachable = false
+	metrics.RpcEndpointCredentialError.WithLabelValues(endpointURL).Set(1)
+	metrics.RpcEndpointIsActive.WithLabelValues(endpointURL).Set(0)
+}
+
+// clearCredentialError re-enables an endpoint whose credentials were
+// accepted again. The caller must hold ep.Mutex for writing.
+func clearCredentialError(ep *types.RpcEndpoint) {
+	if !ep.HasCredentialError {
+		return
+	}
+	log.Printf("🔑 Credentials accepted again by %s", ep.URL.String())
+	ep.HasCredentialError = false
+	metrics.RpcEndpointCredentialError.WithLabelValues(ep.URL.String()).Set(0)
+}
+
+// skipCredentialCheck reports whether a flagged endpoint should not be
+// health-checked yet: always in manual mode, or until its backoff expires.
+// The caller must hold ep.Mutex for reading.
+func (gw *Gateway) skipCredentialCheck(ep *types.RpcEndpoint, now time.Time) bool {
+	if !ep.HasCredentialError {
+		return false
+	}
+	if gw.config.CredentialErrorMode == config.CredentialErrorManual {
+		return true
+	}
+	return now.Before(ep.CredentialRetryAt)
+}
@@ -0,0 +1,111 @@
+package gateway
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"rpc-load-balancer/internal/config"
+	"rpc-load-balancer/internal/types"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// writeError writes a gateway-generated error in the format the client asked
+// for: a JSON-RPC error object, a plain JSON object, or text.
+func (gw *Gateway) writeError(w http.ResponseWriter, r *http.Request, status int, code int, message string) {
+	format := gw.config.ErrorFormat
+	if format == config.ErrorFormatAuto {
+		format = negotiateErrorFormat(r)
+	}
+
+	switch format {
+	case config.ErrorFormatText:
+		http.Error(w, message, status)
+	case config.ErrorFormatJSON:
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]any{"error": message, "status": status})
+	default:
+		resp := types.JsonRpcResponse{
+			Jsonrpc: "2.0",
+			Error:   &types.JsonRpcError{Code: code, Message: message},
+			ID:      requestID(r),
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// requestID returns the id to echo in a JSON-RPC error: the id of a single
+// call, or null for batches and unparseable bodies.
+func requestID(r *http.Request) json.RawMessage {
+	state := stateFromContext(r.Context())
+	if state != nil && state.payload != nil && !state.payload.IsBatch && state.payload.Calls[0].ID != nil {
+		return state.payload.Calls[0].ID
+	}
+	return json.RawMessage("null")
+}
+
+// negotiateErrorFormat picks an error format from the Accept header. JSON
+// clients get a JSON-RPC error for RPC calls and a plain JSON object
+// otherwise; clients that prefer text get text. Without a usable Accept
+// header the error is written as JSON-RPC.
+func negotiateErrorFormat(r *http.Request) string {
+	for _, mediaType := range acceptedMediaTypes(r.Header.Get("Accept")) {
+		switch {
+		case mediaType == "text/plain" || mediaType == "text/html" || mediaType == "text/*":
+			return config.ErrorFormatText
+		case mediaType == "application/json" || mediaType == "application/*" || mediaType == "*/*":
+			if isRpcRequest(r) {
+				return config.ErrorFormatJSONRPC
+			}
+			return config.ErrorFormatJSON
+		}
+	}
+	return config.ErrorFormatJSONRPC
+}
+
+// isRpcRequest reports whether the request looks like a JSON-RPC call.
+func isRpcRequest(r *http.Request) bool {
+	state := stateFromContext(r.Context())
+	if state != nil && state.payload != nil {
+		return true
+	}
+	return r.Method == http.MethodPost
+}
+
+// acceptedMediaTypes parses an Accept header into media types ordered by
+// descending quality, dropping those with q=0.
+func acceptedMediaTypes(accept string) []string {
+	type weighted struct {
+		mediaType string
+		q         float64
+	}
+	var entries []weighted
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		if q > 0 {
+			entries = append(entries, weighted{mediaType, q})
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].q > entries[j].q })
+
+	mediaTypes := make([]string, len(entries))
+	for i, e := range entries {
+		mediaTypes[i] = e.mediaType
+	}
+	return mediaTypes
+}
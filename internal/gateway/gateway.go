@@ -1,63 +1,206 @@
 package gateway
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
-	"net/url"
+	"rpc-load-balancer/internal/audit"
 	"rpc-load-balancer/internal/config"
+	"rpc-load-balancer/internal/metrics"
+	"rpc-load-balancer/internal/ratelimit"
 	"rpc-load-balancer/internal/types"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
 )
 
 // Gateway manages all endpoints, the selection process, and the HTTP client.
 type Gateway struct {
-	Endpoints   []*types.RpcEndpoint
-	CurrentBest *types.RpcEndpoint
-	client      *http.Client
-	mutex       sync.RWMutex
-	config      *config.Config
+	// chain is the name of the chain served, which labels the gateway-level
+	// metrics. It is empty for a single-chain gateway.
+	chain string
+	// endpointSet holds the configured endpoints. It is replaced as a whole
+	// when the configuration is reloaded, so readers need no lock.
+	endpointSet atomic.Pointer[endpointSet]
+	// endpointsMu serializes changes to the endpoint set: reloads and
+	// endpoints added through the admin API
+	endpointsMu sync.Mutex
+	// ranked holds the candidates of the last selection pass, best first.
+	// It is read on every proxied request, so it is an atomic pointer to an
+	// immutable slice rather than a field guarded by a lock.
+	ranked         atomic.Pointer[[]*types.RpcEndpoint]
+	promotedAt     atomic.Int64                 // UnixNano of the last best change, 0 before the first
+	pool           atomic.Pointer[weightedPool] // nil unless loadBalancing is weighted
+	transport      *http.Transport              // Shared by endpoints without their own
+	config         *config.Config
+	methodLimiters map[string]*methodLimiter
+	clientLimiter  *ratelimit.Limiter // nil without clientRateLimit
+	retryBudget    *rate.Limiter      // nil without retryBudget
+	// headerAllowlist holds the forwarded client headers, nil forwards all
+	headerAllowlist map[string]bool
+	// validated is set once a selection pass has found a healthy endpoint,
+	// i.e. currentBest is no longer the unchecked first endpoint.
+	validated atomic.Bool
+	// noHealthy is set while the last selection pass found no healthy endpoint
+	noHealthy atomic.Bool
+	audit     *audit.Logger
+	// canaryRolledBack is set once the canary exceeded its error rate
+	canaryRolledBack atomic.Bool
+	// responseTransforms holds the transforms applied to each method's results
+	responseTransforms map[string][]ResponseTransform
+	// reloadInterval passes a reloaded checkInterval to the checker
+	reloadInterval chan time.Duration
+	// webSocketProxy forwards WebSocket upgrade requests to an endpoint's wsUrl
+	webSocketProxy http.Handler
+	cache          *responseCache  // nil without cacheableMethods
+	sticky         *stickySessions // nil unless stickySessions is enabled
+	// inFlight tracks proxied requests, including WebSocket connections
+	// that the HTTP server no longer tracks once they are hijacked
+	inFlight sync.WaitGroup
+	// stopChecker stops the health checker started by StartChecker, which
+	// closes checkerDone when it has exited
+	stopChecker context.CancelFunc
+	checkerDone chan struct{}
 }
 
 // NewGateway creates and initializes a new Gateway using the loaded configuration.
 func NewGateway(cfg *config.Config) (*Gateway, error) {
+	auditLog, err := audit.Open(cfg.AuditLog)
+	if err != nil {
+		return nil, err
+	}
+	gw, err := newGateway("", cfg, auditLog)
+	if err != nil {
+		auditLog.Close()
+		return nil, err
+	}
+	return gw, nil
+}
+
+// newGateway creates a gateway for the named chain writing to auditLog,
+// which may be shared with other gateways.
+func newGateway(chain string, cfg *config.Config, auditLog *audit.Logger) (*Gateway, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.ConnectTimeout > 0 {
+		setConnectTimeout(transport, cfg.ConnectTimeout)
+	}
+	setConnectionPooling(transport, cfg)
+	// Proxied calls such as a heavy eth_call may take far longer than a
+	// health check, which is limited by its own client timeout instead
+	transport.ResponseHeaderTimeout = cfg.ProxyTimeout
 	gw := &Gateway{
-		client: &http.Client{
-			Timeout: cfg.RequestTimeout, // Use timeout from config
-		},
-		config: cfg, // Store config reference
+		chain:           chain,
+		transport:       transport,
+		config:          cfg, // Store config reference
+		methodLimiters:  newMethodLimiters(cfg.MethodRateLimits),
+		clientLimiter:   newClientLimiter(cfg.ClientRateLimit),
+		retryBudget:     newRetryBudget(cfg.RetryBudget),
+		headerAllowlist: newHeaderAllowlist(cfg.ClientHeaders.Forward),
+		reloadInterval:  make(chan time.Duration, 1),
+	}
+	transforms, err := newResponseTransforms(cfg.ResponseTransforms)
+	if err != nil {
+		return nil, err
 	}
+	gw.responseTransforms = transforms
+	gw.webSocketProxy = gw.newWebSocketProxy()
+	gw.cache = newResponseCache(cfg.CacheTTLs, cfg.CacheMaxEntries)
+	gw.sticky = newStickySessions(cfg.StickySessions.Enabled, cfg.StickySessions.TTL)
 
-	for _, endpointStr := range cfg.RpcEndpoints { // Use endpoints from config
-		parsedURL, err := url.Parse(endpointStr)
+	var endpoints []*types.RpcEndpoint
+	for _, epCfg := range cfg.RpcEndpoints { // Use endpoints from config
+		ep, err := gw.newEndpoint(cfg, epCfg)
 		if err != nil {
-			log.Printf("Warning: Skipping invalid endpoint URL %s: %v", endpointStr, err)
+			log.Printf("Warning: Skipping invalid endpoint URL %s: %v", epCfg.URL, err)
 			continue
 		}
-		gw.Endpoints = append(gw.Endpoints, &types.RpcEndpoint{
-			URL: parsedURL,
-		})
+		endpoints = append(endpoints, ep)
 	}
 
-	if len(gw.Endpoints) == 0 {
+	if len(endpoints) == 0 {
 		return nil, errors.New("no valid RPC endpoints provided in configuration")
 	}
+	set := gw.newEndpointSet(endpoints)
+	if set.canary != nil {
+		metrics.RpcCanaryActive.WithLabelValues(gw.chain).Set(1)
+	}
+	initial := set.initial()
 
-	gw.CurrentBest = gw.Endpoints[0]
-	log.Printf("Gateway initialized with %d endpoints. Initial best: %s", len(gw.Endpoints), gw.CurrentBest.URL.String())
+	// Publish every endpoint's series from the start, so dashboards do not
+	// show gaps before the first selection pass. The initial endpoint serves
+	// until then, so it is marked as the current best.
+	for _, ep := range set.all {
+		publishEndpointMetrics(ep, ep == initial)
+	}
+	gw.endpointSet.Store(set)
+	gw.audit = auditLog
+
+	gw.ranked.Store(&[]*types.RpcEndpoint{initial})
+	log.Printf("Gateway initialized with %d endpoints. Initial best: %s", len(set.all), initial.URL.String())
 	return gw, nil
 }
 
-// GetBestEndpoint safely retrieves the current best endpoint.
+// Shutdown waits for in-flight proxy requests to finish, including WebSocket
+// connections, which http.Server.Shutdown does not wait for. Call it once the
+// gateway server has stopped accepting requests. It returns an error if
+// requests are still running when ctx ends. The checker is stopped
+// separately by StopChecker, so the shutdown order decides whether health
+// checks keep running while requests drain.
+func (gw *Gateway) Shutdown(ctx context.Context) error {
+	drained := make(chan struct{})
+	go func() {
+		gw.inFlight.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("requests still in flight: %w", ctx.Err())
+	}
+}
+
+// Close releases resources held by the gateway, flushing the audit log.
+func (gw *Gateway) Close() error {
+	return gw.audit.Close()
+}
+
+// GetBestEndpoint returns the current best endpoint, the first of the
+// ranking. It is lock-free.
 func (gw *Gateway) GetBestEndpoint() *types.RpcEndpoint {
-	gw.mutex.RLock()
-	defer gw.mutex.RUnlock()
-	return gw.CurrentBest
+	ranked := gw.ranked.Load()
+	if ranked == nil || len(*ranked) == 0 {
+		return nil
+	}
+	return (*ranked)[0]
+}
+
+// GetRankedEndpoints returns the healthy candidates of the last selection
+// pass, best first. The slice is shared and must not be modified.
+func (gw *Gateway) GetRankedEndpoints() []*types.RpcEndpoint {
+	ranked := gw.ranked.Load()
+	if ranked == nil {
+		return nil
+	}
+	return *ranked
+}
+
+// setRanking atomically replaces the ranking, recording when its first
+// endpoint changed.
+func (gw *Gateway) setRanking(ranked []*types.RpcEndpoint) {
+	previous := gw.GetBestEndpoint()
+	gw.ranked.Store(&ranked)
+	if len(ranked) > 0 && ranked[0] != previous {
+		gw.promotedAt.Store(time.Now().UnixNano())
+	}
 }
 
-// setBestEndpoint safely sets the current best endpoint.
-func (gw *Gateway) setBestEndpoint(endpoint *types.RpcEndpoint) {
-	gw.mutex.Lock()
-	defer gw.mutex.Unlock()
-	gw.CurrentBest = endpoint
+// HasValidatedEndpoint reports whether any selection pass has found a
+// healthy endpoint since startup.
+func (gw *Gateway) HasValidatedEndpoint() bool {
+	return gw.validated.Load()
 }
@@ -0,0 +1,140 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"rpc-load-balancer/internal/config"
+	"rpc-load-balancer/internal/types"
+	"strings"
+	"testing"
+)
+
+// newTestGateway creates a gateway for the endpoints at urls, configured by
+// extra YAML besides the endpoint list.
+func newTestGateway(t testing.TB, extra string, urls ...string) *Gateway {
+	t.Helper()
+	var yaml strings.Builder
+	yaml.WriteString(extra + "\nrpcEndpoints:\n")
+	for _, u := range urls {
+		fmt.Fprintf(&yaml, "  - url: %q\n", u)
+	}
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(yaml.String()), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.ReloadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gw, err := NewGateway(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { gw.Close() })
+	return gw
+}
+
+// newTestUpstream starts a JSON-RPC endpoint at block 100 that answers other
+// calls with "0x1". observe, if not nil, is called with every request.
+func newTestUpstream(t testing.TB, observe func(r *http.Request)) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if observe != nil {
+			observe(r)
+		}
+		var call types.JsonRpcRequest
+		json.NewDecoder(r.Body).Decode(&call)
+		var result any = "0x1"
+		switch call.Method {
+		case "eth_blockNumber":
+			result = "0x64"
+		case syncingMethod:
+			result = false
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "id": call.ID, "result": result})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestProxyHandlerWithoutEndpoint(t *testing.T) {
+	upstream := newTestUpstream(t, nil)
+	gw := newTestGateway(t, "", upstream.URL)
+	// The pool emptied at runtime, after an endpoint had been validated
+	gw.validated.Store(true)
+	gw.setRanking(nil)
+	if gw.GetBestEndpoint() != nil {
+		t.Fatal("GetBestEndpoint() returned an endpoint after clearing the ranking")
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber"}`))
+	rec := httptest.NewRecorder()
+	gw.ProxyHandler().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	var resp types.JsonRpcResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("response is not JSON-RPC: %v (%s)", err, rec.Body)
+	}
+	if resp.Error == nil || resp.Error.Message != "no endpoints configured" {
+		t.Errorf("error = %+v, want \"no endpoints configured\"", resp.Error)
+	}
+}
+
+func TestSelectBestEndpointWithoutEndpoints(t *testing.T) {
+	upstream := newTestUpstream(t, nil)
+	gw := newTestGateway(t, "", upstream.URL)
+	gw.endpointSet.Store(&endpointSet{})
+
+	gw.SelectBestEndpoint()
+
+	if best := gw.GetBestEndpoint(); best != nil {
+		t.Errorf("GetBestEndpoint() = %s, want nil", best.URL)
+	}
+	if ranked := gw.GetRankedEndpoints(); len(ranked) != 0 {
+		t.Errorf("GetRankedEndpoints() has %d endpoints, want none", len(ranked))
+	}
+}
+
+// BenchmarkGetBestEndpoint reads the best endpoint from every P while
+// selection passes keep replacing it. Run it with -race to check the
+// lock-free read.
+func BenchmarkGetBestEndpoint(b *testing.B) {
+	log.SetOutput(dropWriter{})
+	b.Cleanup(func() { log.SetOutput(os.Stderr) })
+	gw := newTestGateway(b, "", newTestUpstream(b, nil).URL, newTestUpstream(b, nil).URL)
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				gw.SelectBestEndpoint()
+			}
+		}
+	}()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if gw.GetBestEndpoint() == nil {
+				b.Error("GetBestEndpoint() returned nil")
+				return
+			}
+		}
+	})
+	b.StopTimer()
+	close(stop)
+	<-done
+}
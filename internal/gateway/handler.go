@@ -1,79 +1,579 @@
 package gateway
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
 	"log"
+	"math"
 	"net/http"
 	"net/http/httputil"
+	"os"
+	"rpc-load-balancer/internal/config"
+	"rpc-load-balancer/internal/logging"
 	"rpc-load-balancer/internal/metrics"
+	"rpc-load-balancer/internal/tracing"
+	"rpc-load-balancer/internal/types"
 	"rpc-load-balancer/internal/utils"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 )
 
+type contextKey int
+
+// stateContextKey carries the requestState of a proxied request.
+const stateContextKey contextKey = iota
+
+// requestState carries per-request data between the handler, the director and
+// modifyResponse, so they agree on the endpoint even if the best changes mid-flight.
+type requestState struct {
+	clientIP string
+	endpoint *types.RpcEndpoint // Replaced by the hedge target if it answers first
+	path     string             // Path requested by the client
+	body     *requestBody
+	payload  *rpcPayload // nil when the body is not valid JSON-RPC
+	method   string      // Bounded method label for metrics
+	variant  string      // A/B variant, see variants
+	// streaming is set once the upstream response is being sent to the client
+	streaming bool
+	// upgraded is set when the upstream switched protocols; the 101 goes out
+	// on the hijacked connection, bypassing the response writer
+	upgraded bool
+	cacheKey string // Set for cacheable requests, see cacheKey
+	cached   bool   // Answered from the response cache
+	// denied holds the calls of a batch that methodFilter answers with an
+	// error, and unfiltered the batch before they were taken out of payload
+	denied     *batchPart
+	unfiltered *rpcPayload
+
+	// requestID is the client's X-Request-Id, or a generated one
+	requestID string
+	// clientHeader holds the client's headers after stripHeaders, to undo
+	// an endpoint's headers when the request is resent to another one
+	clientHeader http.Header
+}
+
+// stateFromContext returns the requestState attached to a proxied request.
+func stateFromContext(ctx context.Context) *requestState {
+	state, _ := ctx.Value(stateContextKey).(*requestState)
+	return state
+}
+
 // ProxyHandler creates the reverse proxy handler.
-// It now uses gw.config.RateLimitBackoff when flagging.
+// Rate-limited endpoints are backed off with gw.markRateLimited.
 func (gw *Gateway) ProxyHandler() http.Handler {
 
 	director := func(req *http.Request) {
-		best := gw.GetBestEndpoint()
-		targetURL := best.URL
-
-		req.URL.Scheme = targetURL.Scheme
-		req.URL.Host = targetURL.Host
-		req.URL.Path = targetURL.Path
-		req.Host = targetURL.Host
+		state := stateFromContext(req.Context())
+		gw.setForwardedHost(req)
+		gw.setUpstream(req, state.endpoint, state.path)
+		mapRequestMethods(req, state.endpoint, state.payload)
+		// Set again, as a clientHeaders allowlist may have dropped it
+		req.Header.Set(requestIDHeader, state.requestID)
+		tracing.Inject(req.Context(), req.Header)
 
-		log.Printf("  -> Forwarding %s %s to %s", req.Method, req.URL.Path, targetURL.String())
+		log.Printf("  -> [%s] Forwarding %s %s to %s", state.requestID, req.Method, req.URL.Path, state.endpoint.URL.Redacted())
 	}
 
 	modifyResponse := func(resp *http.Response) error {
+		state := stateFromContext(resp.Request.Context())
+		ep := state.endpoint
+		endpointURL := ep.URL.String()
+
+		metrics.RpcUpstreamResponsesTotal.WithLabelValues(endpointURL, strconv.Itoa(resp.StatusCode)).Inc()
+		upstreamBytes := metrics.RpcUpstreamResponseBytes.WithLabelValues(endpointURL, state.method)
+		resp.Body = &utils.CountingReadCloser{
+			ReadCloser: resp.Body,
+			OnRead:     func(n int) { upstreamBytes.Add(float64(n)) },
+			OnError: func(err error) {
+				if !state.streaming || resp.Request.Context().Err() != nil {
+					// Failed before the headers went out, or the client went away
+					return
+				}
+				gw.upstreamReset(ep, err)
+			},
+		}
+
+		if len(gw.config.CORS.AllowedOrigins) > 0 {
+			stripCORSHeaders(resp.Header)
+		}
+		// The client already gets the request ID from the handler
+		resp.Header.Del(requestIDHeader)
+		if ep.Config.Region != "" {
+			resp.Header.Set("X-Rpc-Gateway-Region", ep.Config.Region)
+		}
+
+		ep.Mutex.Lock()
+		quotaLow := updateQuota(ep, resp.Header)
+		gw.recordProxyOutcome(ep, resp.StatusCode >= http.StatusInternalServerError)
+		ep.Mutex.Unlock()
+		if quotaLow {
+			log.Printf("🪫 Quota nearly exhausted for %s", endpointURL)
+			go gw.SelectBestEndpoint()
+		}
+
+		if isCredentialError(resp.StatusCode) {
+			ep.Mutex.Lock()
+			gw.markCredentialError(ep, resp.StatusCode)
+			ep.Mutex.Unlock()
+			go gw.SelectBestEndpoint()
+		}
+
 		if resp.StatusCode == http.StatusTooManyRequests {
-			best := gw.GetBestEndpoint()
-			endpointURL := best.URL.String()
-			log.Printf("🚦 Rate limit detected during forward to %s", endpointURL)
+			logging.Limitedf("🚦 Rate limit detected during forward to %s", endpointURL)
 
-			best.Mutex.Lock()
-			best.IsRateLimited = true
-			best.RateLimitedUntil = time.Now().Add(gw.config.RateLimitBackoff)
-			best.Mutex.Unlock()
+			ep.Mutex.Lock()
+			gw.markRateLimited(ep, time.Now())
+			ep.Mutex.Unlock()
 
 			metrics.RpcRateLimitsTotal.WithLabelValues(endpointURL, "proxy").Inc() // <-- Inc rate limit
 
 			go gw.SelectBestEndpoint()
 		}
+
+		if state.payload != nil {
+			if gw.config.MaxErrorRate > 0 {
+				if err := gw.inspectRpcErrors(resp, ep); err != nil {
+					return err
+				}
+			}
+			if gw.config.NormalizeResponses {
+				if err := gw.normalizeResponse(resp, state.payload); err != nil {
+					return err
+				}
+			}
+			if err := stripNotificationResponses(resp, state.payload); err != nil {
+				return err
+			}
+			if err := gw.transformResponse(resp, state.payload); err != nil {
+				return err
+			}
+			if state.cacheKey != "" {
+				if err := gw.storeResponse(resp, state); err != nil {
+					return err
+				}
+			}
+		}
+		state.streaming = true
 		return nil
 	}
 
 	errorHandler := func(w http.ResponseWriter, r *http.Request, err error) {
-		log.Printf("❌ Proxy error: %v", err)
-		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+		logging.Limitedf("❌ Proxy error: %v", err)
+		if state := stateFromContext(r.Context()); state != nil {
+			state.endpoint.Mutex.Lock()
+			gw.recordProxyOutcome(state.endpoint, true)
+			state.endpoint.Mutex.Unlock()
+		}
+		if timeoutReason(err) == "response_timeout" {
+			gw.writeError(w, r, http.StatusGatewayTimeout, rpcCodeServerError, "Gateway Timeout")
+			return
+		}
+		gw.writeError(w, r, http.StatusBadGateway, rpcCodeServerError, "Bad Gateway")
 	}
 
 	proxyHandler := &httputil.ReverseProxy{
 		Director:       director,
+		Transport:      &proxyTransport{gw: gw},
 		ModifyResponse: modifyResponse,
 		ErrorHandler:   errorHandler,
 	}
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gw.inFlight.Add(1)
+		defer gw.inFlight.Done()
 		startTime := time.Now()
 		ip := utils.GetRequestIP(r)
+		// Compress below the logging writer, which counts uncompressed
+		// bytes; the compressing writer counts the bytes actually sent
+		cw := gw.newCompressWriter(w, r)
+		if cw != nil {
+			w = cw
+		}
 		lrw := utils.NewLoggingResponseWriter(w)
 
-		// Get endpoint *before* proxying (best guess)
-		currentEndpoint := gw.GetBestEndpoint().URL.String()
+		// Pin the endpoint for this request before proxying
+		state := &requestState{clientIP: ip, endpoint: gw.pickEndpoint(ip), path: r.URL.Path, method: metrics.MethodLabelNone}
+		state.requestID = newRequestID(r.Header.Get(requestIDHeader))
+		r.Header.Set(requestIDHeader, state.requestID)
+		lrw.Header().Set(requestIDHeader, state.requestID)
+		currentEndpoint := endpointLabel(state.endpoint)
+		ctx, span := tracing.StartServerSpan(r, "proxy")
+		r = r.WithContext(context.WithValue(ctx, stateContextKey, state))
 
-		log.Printf("📥 [%s] --> %s %s (to %s)", ip, r.Method, r.URL.String(), currentEndpoint)
+		if !logging.Structured() {
+			log.Printf("📥 [%s] [%s] --> %s %s (to %s)", ip, state.requestID, r.Method, r.URL.String(), currentEndpoint)
+		}
 
-		proxyHandler.ServeHTTP(lrw, r) // Use our proxy
+		gw.serveProxy(proxyHandler, lrw, r, state)
+		sentBytes := lrw.BytesWritten
+		if cw != nil {
+			cw.Close()
+			sentBytes = cw.sent
+		}
 
 		duration := time.Since(startTime)
-		statusCodeStr := strconv.Itoa(lrw.StatusCode)
+		currentEndpoint = endpointLabel(state.endpoint) // A hedge may have answered
+		if state.cached {
+			currentEndpoint = "cache"
+		}
+		status := lrw.StatusCode
+		if state.upgraded {
+			status = http.StatusSwitchingProtocols
+		}
+		statusCodeStr := strconv.Itoa(status)
+		endRequestSpan(span, state, currentEndpoint, status)
 
 		// Update Prometheus Metrics
 		metrics.HttpRequestDuration.WithLabelValues(r.Method, statusCodeStr, currentEndpoint).Observe(duration.Seconds())
 		metrics.HttpRequestTotal.WithLabelValues(r.Method, statusCodeStr, currentEndpoint).Inc()
+		metrics.RpcGatewayResponseBytes.WithLabelValues(currentEndpoint, state.method).Add(float64(lrw.BytesWritten))
+		metrics.RpcGatewaySentBytes.WithLabelValues(currentEndpoint, state.method).Add(float64(sentBytes))
+		metrics.RpcRequestSizeBytes.WithLabelValues(state.method, gw.chain).Observe(float64(requestSize(r, state)))
+		metrics.RpcResponseSizeBytes.WithLabelValues(state.method, gw.chain).Observe(float64(lrw.BytesWritten))
+		if state.variant != "" {
+			metrics.RpcVariantRequestsTotal.WithLabelValues(state.variant, statusCodeStr, gw.chain).Inc()
+			metrics.RpcVariantRequestDuration.WithLabelValues(state.variant, gw.chain).Observe(duration.Seconds())
+		}
+		if gw.audit.LogsRequests() {
+			gw.audit.Request(ip, state.payload.methods(), currentEndpoint, status, duration)
+		}
 
-		log.Printf("📤 [%s] <-- %s %s - Status %d (%v)", ip, r.Method, r.URL.String(), lrw.StatusCode, duration)
+		if logging.Structured() {
+			logging.Logger.Info("request", "request_id", state.requestID, "ip", ip, "method", r.Method, "path", r.URL.Path, "rpc_method", state.method,
+				"status", status, "duration_ms", float64(duration.Microseconds())/1000, "upstream", currentEndpoint)
+			return
+		}
+		log.Printf("📤 [%s] [%s] <-- %s %s - Status %d (%v)", ip, state.requestID, r.Method, r.URL.String(), status, duration)
 	})
 }
+
+// requestSize returns the size of the request body: the buffered size when
+// the body was read, else the announced Content-Length.
+func requestSize(r *http.Request, state *requestState) int64 {
+	if state.body != nil {
+		return state.body.Len()
+	}
+	return max(r.ContentLength, 0)
+}
+
+// endpointLabel returns the endpoint's URL for logs and metrics, or "none"
+// when the pool is empty.
+func endpointLabel(ep *types.RpcEndpoint) string {
+	if ep == nil {
+		return "none"
+	}
+	return ep.URL.String()
+}
+
+// upstreamReset handles an upstream failing while its response body was being
+// streamed. The status and headers have already reached the client, so the
+// request cannot be retried; the endpoint is counted as failing and
+// re-checked. The proxy then aborts the client connection, so the client
+// sees an error rather than a silently truncated body.
+func (gw *Gateway) upstreamReset(ep *types.RpcEndpoint, err error) {
+	endpointURL := ep.URL.String()
+	logging.Limitedf("💥 Upstream %s failed mid-response, client received a partial response: %v", endpointURL, err)
+	metrics.RpcUpstreamResetTotal.WithLabelValues(endpointURL).Inc()
+
+	ep.Mutex.Lock()
+	gw.recordProxyOutcome(ep, true)
+	ep.Mutex.Unlock()
+	go gw.SelectBestEndpoint()
+}
+
+// setUpstream points an outgoing request at the endpoint and adds the
+// endpoint's headers. The Host header names the endpoint unless
+// preserveHostHeader keeps the client's.
+func (gw *Gateway) setUpstream(req *http.Request, ep *types.RpcEndpoint, clientPath string) {
+	req.URL.Scheme = ep.URL.Scheme
+	req.URL.Host = ep.URL.Host
+	req.URL.Path = upstreamPath(ep.URL.Path, clientPath, ep.Config.PathMode)
+	req.URL.RawPath = ""
+	if !gw.config.PreserveHostHeader {
+		req.Host = ep.URL.Host
+	}
+	setEndpointHeaders(req.Header, ep)
+}
+
+// setForwardedHost passes the Host header the client sent in
+// X-Forwarded-Host when xForwardedHost is set. It must be called before the
+// request is pointed at an endpoint.
+func (gw *Gateway) setForwardedHost(req *http.Request) {
+	if gw.config.XForwardedHost {
+		req.Header.Set("X-Forwarded-Host", req.Host)
+	}
+}
+
+// setEndpointHeaders sets the endpoint's configured headers and credentials,
+// replacing client headers of the same name.
+func setEndpointHeaders(header http.Header, ep *types.RpcEndpoint) {
+	for name, values := range ep.Headers {
+		header[name] = values
+	}
+}
+
+// resetEndpointHeaders undoes setEndpointHeaders for a request about to be
+// resent to another endpoint, so prev's credentials never reach it: headers
+// the client sent get the client's values back, the others are removed.
+func resetEndpointHeaders(header http.Header, prev *types.RpcEndpoint, client http.Header) {
+	for name := range prev.Headers {
+		if values, ok := client[name]; ok {
+			header[name] = slices.Clone(values)
+		} else {
+			delete(header, name)
+		}
+	}
+}
+
+// mapRequestMethods rewrites the request body for an endpoint with a method
+// map. Responses carry no method names, so they need no reverse mapping.
+func mapRequestMethods(req *http.Request, ep *types.RpcEndpoint, payload *rpcPayload) {
+	if len(ep.Config.MethodMap) == 0 || payload == nil {
+		return
+	}
+	body, ok := payload.mapMethods(ep.Config.MethodMap)
+	if !ok {
+		return
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+}
+
+// rejectOversizedRequest answers a request whose body exceeds
+// maxRequestBytes with a 413.
+func (gw *Gateway) rejectOversizedRequest(w http.ResponseWriter, r *http.Request, state *requestState) {
+	logging.Limitedf("📏 Rejected request from %s: body exceeds %d bytes", state.clientIP, gw.config.MaxRequestBytes)
+	metrics.RpcOversizedRequestsTotal.WithLabelValues(gw.chain).Inc()
+	gw.writeError(w, r, http.StatusRequestEntityTooLarge, rpcCodeInvalidRequest, "request body too large")
+}
+
+// replaceBody re-encodes the possibly modified payload and makes it the body
+// sent upstream. The original buffered body is still released by serveProxy.
+func (gw *Gateway) replaceBody(r *http.Request, state *requestState) error {
+	data, err := state.payload.encode()
+	if err != nil {
+		return err
+	}
+	state.body = newMemoryBody(data)
+	r.Body = state.body.NewReader()
+	r.ContentLength = state.body.Len()
+	return nil
+}
+
+// serveProxy buffers and inspects the JSON-RPC body, applies the gateway's
+// request policies and forwards the request. Requests rejected by a policy
+// are answered directly without reaching an upstream.
+func (gw *Gateway) serveProxy(proxy http.Handler, w http.ResponseWriter, r *http.Request, state *requestState) {
+	if gw.handleCORS(w, r) {
+		return
+	}
+	if !slices.Contains(gw.config.AllowedMethods, r.Method) {
+		w.Header().Set("Allow", strings.Join(gw.config.AllowedMethods, ", "))
+		gw.writeError(w, r, http.StatusMethodNotAllowed, rpcCodeInvalidRequest, "method "+r.Method+" not allowed")
+		return
+	}
+	if retryAfter, limited := gw.clientRateLimited(state.clientIP); limited {
+		logging.Limitedf("🚦 Client rate limit exceeded by %s", state.clientIP)
+		metrics.RpcClientRateLimitedTotal.WithLabelValues(state.clientIP, gw.chain).Inc()
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		gw.writeError(w, r, http.StatusTooManyRequests, rpcCodeLimitExceeded, "rate limit exceeded")
+		return
+	}
+
+	if gw.config.StartupMode == config.StartupServeWith503 && !gw.HasValidatedEndpoint() {
+		gw.writeError(w, r, http.StatusServiceUnavailable, rpcCodeServerError, "no healthy upstream endpoint available yet")
+		return
+	}
+	if gw.config.NoHealthyEndpoints == config.NoHealthyServeWith503 && gw.noHealthy.Load() {
+		gw.writeError(w, r, http.StatusServiceUnavailable, rpcCodeServerError, "no healthy upstream endpoint available")
+		return
+	}
+
+	if len(gw.config.Variants.Pools) > 0 {
+		// Read before stripHeaders, which may drop the variant header
+		state.variant = gw.requestVariant(r)
+	}
+	gw.stripHeaders(r.Header)
+	state.clientHeader = r.Header
+	if gw.headersTooLarge(r.Header) {
+		log.Printf("📏 [%s] Rejected request from %s: headers exceed %d bytes", state.requestID, state.clientIP, gw.config.ClientHeaders.MaxBytes)
+		metrics.RpcOversizedHeadersTotal.WithLabelValues(gw.chain).Inc()
+		gw.writeError(w, r, http.StatusRequestHeaderFieldsTooLarge, rpcCodeInvalidRequest, "request headers too large")
+		return
+	}
+	if isWebSocketUpgrade(r) {
+		if gw.filteringMethods() {
+			// Frames are relayed without being inspected, so they would
+			// bypass the filter
+			gw.writeError(w, r, http.StatusForbidden, rpcCodeInvalidRequest, "WebSocket connections are not available on this gateway")
+			return
+		}
+		gw.serveWebSocket(w, r, state)
+		return
+	}
+
+	if limit := gw.config.MaxRequestBytes; limit > 0 && r.Body != nil {
+		if r.ContentLength > limit {
+			gw.rejectOversizedRequest(w, r, state)
+			return
+		}
+		// Also caps bodies without a Content-Length, before they are buffered
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+	}
+
+	if r.Method == http.MethodPost && r.Body != nil {
+		body, err := gw.readBody(w, r)
+		r.Body.Close()
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			log.Printf("⏱️ [%s] Timed out reading request body from %s", state.requestID, state.clientIP)
+			gw.writeError(w, r, http.StatusRequestTimeout, rpcCodeServerError, "timed out reading request body")
+			return
+		}
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			gw.rejectOversizedRequest(w, r, state)
+			return
+		}
+		if err != nil {
+			logging.Limitedf("❌ Failed to read request body: %v", err)
+			gw.writeError(w, r, http.StatusBadRequest, rpcCodeParseError, "failed to read request body")
+			return
+		}
+		defer body.release()
+
+		state.body = body
+		payload, err := parseRpcPayload(body.NewReader())
+		if errors.Is(err, errInvalidBatch) {
+			gw.writeError(w, r, http.StatusBadRequest, batchErrorCode(err), err.Error())
+			return
+		}
+		state.payload = payload
+		state.method = methodLabel(state.payload)
+		// The buffered size is known, so send a Content-Length upstream
+		r.Body = body.NewReader()
+		r.ContentLength = body.Len()
+		r.TransferEncoding = nil
+		if gw.config.ExpectContinue == config.ExpectContinueAnswer {
+			// Reading the body made the server send 100 Continue; the
+			// upstream gets the whole body at once and should not make the
+			// transport wait for its own 100 on every attempt
+			r.Header.Del("Expect")
+		}
+	}
+
+	if state.endpoint == nil {
+		gw.writeError(w, r, http.StatusServiceUnavailable, rpcCodeServerError, "no endpoints configured")
+		return
+	}
+	if gw.filteringMethods() {
+		if state.payload == nil {
+			if r.Body != nil && r.Body != http.NoBody {
+				// A body the filter cannot read might still run a method upstream
+				gw.writeError(w, r, http.StatusBadRequest, rpcCodeParseError, "request body is not valid JSON-RPC")
+				return
+			}
+		} else {
+			if method, denied := gw.filterMethods(state); denied {
+				logging.Limitedf("⛔ [%s] Refused method %s from %s", state.requestID, method, state.clientIP)
+				gw.writeError(w, r, http.StatusForbidden, rpcCodeMethodNotFound, "method "+method+" is not allowed")
+				return
+			}
+			if len(state.payload.Calls) == 0 {
+				gw.serveSplitBatch(proxy, w, r, state) // Nothing left to forward
+				return
+			}
+			// Forward the calls as decoded rather than the client's bytes,
+			// so the upstream runs exactly the methods that were checked
+			// even if the client sent duplicate or differently cased keys
+			if err := gw.replaceBody(r, state); err != nil {
+				log.Printf("❌ [%s] Failed to re-encode request body: %v", state.requestID, err)
+				gw.writeError(w, r, http.StatusInternalServerError, rpcCodeInternalError, "failed to re-encode request body")
+				return
+			}
+		}
+	}
+	splitBatch := gw.config.SplitBatches && state.payload != nil && state.payload.IsBatch && len(state.payload.Calls) > 1
+	if !splitBatch {
+		ep, reason := gw.routeRequest(state)
+		if ep == nil {
+			gw.writeError(w, r, http.StatusServiceUnavailable, rpcCodeServerError, reason)
+			return
+		}
+		state.endpoint = ep
+	}
+
+	if state.payload != nil && gw.config.Notifications == config.NotificationsReject && state.payload.notificationCount() > 0 {
+		gw.writeError(w, r, http.StatusBadRequest, rpcCodeInvalidRequest, "notifications are not supported")
+		return
+	}
+
+	if state.payload != nil {
+		if pattern, limited := gw.checkMethodLimits(state.payload, state.clientIP); limited {
+			logging.Limitedf("🚦 Method rate limit %s exceeded by %s", pattern, state.clientIP)
+			metrics.RpcMethodRateLimitedTotal.WithLabelValues(pattern, gw.chain).Inc()
+			gw.writeError(w, r, http.StatusTooManyRequests, rpcCodeLimitExceeded, "rate limit exceeded for method "+pattern)
+			return
+		}
+
+		changed, err := gw.applyBlockTags(state.payload)
+		if err != nil {
+			gw.writeError(w, r, http.StatusBadRequest, rpcCodeInvalidParams, err.Error())
+			return
+		}
+		if changed {
+			if err := gw.replaceBody(r, state); err != nil {
+				log.Printf("❌ [%s] Failed to re-encode request body: %v", state.requestID, err)
+				gw.writeError(w, r, http.StatusInternalServerError, rpcCodeInternalError, "failed to re-encode request body")
+				return
+			}
+		}
+	}
+
+	if state.cacheKey = gw.cacheKey(state); state.cacheKey != "" {
+		if gw.serveCached(w, state) {
+			return
+		}
+		// Let the transport negotiate and decode compression, so the reply
+		// can be stored
+		r.Header.Del("Accept-Encoding")
+	}
+
+	if splitBatch || state.denied != nil {
+		gw.serveSplitBatch(proxy, w, r, state)
+		return
+	}
+	proxy.ServeHTTP(w, r)
+}
+
+// routeRequest returns the endpoint the request goes to instead of the pinned
+// best: the one its routing rule, A/B variant, the canary split or
+// transaction routing asks for, else best itself. When no healthy endpoint
+// qualifies it returns nil and the reason.
+func (gw *Gateway) routeRequest(state *requestState) (*types.RpcEndpoint, string) {
+	if rule := gw.routingRuleFor(state.payload, state.endpoint); rule != nil {
+		if ep := gw.taggedEndpoint(state.endpoint, rule); ep != nil {
+			return ep, ""
+		}
+		return nil, "no healthy endpoint matches " + rule.Match
+	}
+	if state.variant != "" && (state.variant != variantDefault || gw.config.Variants.Exclusive) {
+		if ep := gw.variantEndpoint(state.endpoint, state.variant); ep != nil {
+			return ep, ""
+		}
+		return nil, "no healthy endpoint in the pool of variant " + state.variant
+	}
+	if canary := gw.canaryEndpoint(state); canary != nil {
+		return canary, ""
+	}
+	if state.payload != nil && state.payload.hasWriteCall() {
+		return gw.txEndpoint(state.endpoint), ""
+	}
+	return state.endpoint, ""
+}
@@ -0,0 +1,101 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// sendExpectContinue sends a request with "Expect: 100-continue" to url. The
+// client holds the body back until the server answers with 100 Continue.
+// It returns the final status and whether a 100 Continue was received.
+func sendExpectContinue(t *testing.T, method, url string) (int, bool) {
+	t.Helper()
+	var mu sync.Mutex
+	got100 := false
+	trace := &httptrace.ClientTrace{
+		Got100Continue: func() {
+			mu.Lock()
+			got100 = true
+			mu.Unlock()
+		},
+	}
+	req, err := http.NewRequest(method, url, strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"eth_chainId"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Expect", "100-continue")
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+
+	client := &http.Client{Transport: &http.Transport{ExpectContinueTimeout: 5 * time.Second}}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	mu.Lock()
+	defer mu.Unlock()
+	return resp.StatusCode, got100
+}
+
+func TestExpectContinue(t *testing.T) {
+	tests := []struct {
+		mode       string
+		wantExpect string
+	}{
+		{mode: "answer", wantExpect: ""},
+		{mode: "forward", wantExpect: "100-continue"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			var mu sync.Mutex
+			var expects []string
+			upstream := newTestUpstream(t, func(r *http.Request) {
+				mu.Lock()
+				expects = append(expects, r.Header.Get("Expect"))
+				mu.Unlock()
+			})
+			gw := newTestGateway(t, "expectContinue: "+tt.mode, upstream.URL)
+			gw.validated.Store(true)
+			server := httptest.NewServer(gw.ProxyHandler())
+			defer server.Close()
+
+			status, got100 := sendExpectContinue(t, http.MethodPost, server.URL)
+			if status != http.StatusOK {
+				t.Errorf("status = %d, want %d", status, http.StatusOK)
+			}
+			if !got100 {
+				t.Error("no 100 Continue before the response")
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if len(expects) != 1 {
+				t.Fatalf("upstream got %d requests, want 1", len(expects))
+			}
+			if expects[0] != tt.wantExpect {
+				t.Errorf("upstream Expect header = %q, want %q", expects[0], tt.wantExpect)
+			}
+		})
+	}
+}
+
+func TestExpectContinueRejected(t *testing.T) {
+	upstream := newTestUpstream(t, nil)
+	gw := newTestGateway(t, "", upstream.URL)
+	gw.validated.Store(true)
+	server := httptest.NewServer(gw.ProxyHandler())
+	defer server.Close()
+
+	status, got100 := sendExpectContinue(t, http.MethodPut, server.URL)
+	if status != http.StatusMethodNotAllowed {
+		t.Errorf("status = %d, want %d", status, http.StatusMethodNotAllowed)
+	}
+	if got100 {
+		t.Error("got 100 Continue for a rejected request")
+	}
+}
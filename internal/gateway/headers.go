@@ -0,0 +1,57 @@
+package gateway
+
+import "net/http"
+
+// essentialHeaders are forwarded even when they are missing from the
+// clientHeaders allowlist, as upstreams need them to parse the request or,
+// for the Connection, Upgrade and Sec-Websocket-* headers, to accept a
+// WebSocket handshake.
+var essentialHeaders = []string{
+	"Content-Type", "Accept", "Accept-Encoding",
+	"Connection", "Upgrade", "Sec-Websocket-Key", "Sec-Websocket-Version",
+	"Sec-Websocket-Protocol", "Sec-Websocket-Extensions",
+}
+
+// newHeaderAllowlist builds the set of forwarded client headers, or returns
+// nil when every header is forwarded.
+func newHeaderAllowlist(forward []string) map[string]bool {
+	if len(forward) == 0 {
+		return nil
+	}
+	allowed := make(map[string]bool, len(forward)+len(essentialHeaders))
+	for _, name := range essentialHeaders {
+		allowed[name] = true
+	}
+	for _, name := range forward {
+		allowed[http.CanonicalHeaderKey(name)] = true
+	}
+	return allowed
+}
+
+// stripHeaders removes the headers missing from the allowlist.
+func (gw *Gateway) stripHeaders(header http.Header) {
+	if gw.headerAllowlist == nil {
+		return
+	}
+	for name := range header {
+		if !gw.headerAllowlist[name] {
+			delete(header, name)
+		}
+	}
+}
+
+// headersTooLarge reports whether the headers exceed clientHeaders.maxBytes,
+// counting them as they appear on the wire.
+func (gw *Gateway) headersTooLarge(header http.Header) bool {
+	limit := gw.config.ClientHeaders.MaxBytes
+	if limit < 0 {
+		return false
+	}
+	size := 0
+	for name, values := range header {
+		for _, value := range values {
+			size += len(name) + len(value) + len(": \r\n")
+		}
+	}
+	return size > limit
+}
@@ -0,0 +1,188 @@
+package gateway
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"rpc-load-balancer/internal/metrics"
+	"rpc-load-balancer/internal/types"
+	"slices"
+	"sort"
+	"time"
+)
+
+// recordOutcome adds the outcome of a health check or proxied request to the
+// endpoint's error window and decays its weight accordingly:
+//
+//	effectiveWeight = weight * max(0, 1 - errorWeightSensitivity*errorRate)
+//
+// The caller must hold the write lock.
+func (gw *Gateway) recordOutcome(ep *types.RpcEndpoint, failed bool) {
+	ep.Outcomes.Add(failed)
+	ep.ErrorRate = ep.Outcomes.Rate()
+	ep.EffectiveWeight = ep.Config.Weight * math.Max(0, 1-gw.config.ErrorWeightSensitivity*ep.ErrorRate)
+	metrics.RpcEndpointEffectiveWeight.WithLabelValues(ep.URL.String()).Set(ep.EffectiveWeight)
+	gw.checkCanary(ep)
+}
+
+// recordUptime adds the result of a health check to the endpoint's uptime
+// window. The caller must hold the write lock.
+func (gw *Gateway) recordUptime(ep *types.RpcEndpoint, now time.Time) {
+	ep.Uptime.Add(now, ep.IsReachable)
+	if ratio, ok := ep.Uptime.Ratio(now); ok {
+		ep.UptimeRatio = ratio
+	}
+	metrics.RpcEndpointUptimePercent.WithLabelValues(ep.URL.String()).Set(ep.UptimeRatio * 100)
+}
+
+// updateHealthScores recomputes the health score of every endpoint.
+//
+// Each component is a value between 0 and 1:
+//
+//	reachability  1 if the last health check succeeded, else 0
+//	latency       share of the other reachable endpoints that are slower (1 when alone)
+//	blockLag      1 - lag/maxBlockLag, clamped to 0, lag measured from the highest block
+//	errorRate     1 - the share of failed checks and requests in the error window
+//	rateLimit     0 while rate limited or rejecting credentials, 0.5 with low quota, else 1
+//
+// The score is 100 * Σ(weight·component) / Σ(weight). Latency and block lag
+// count as 0 for unreachable endpoints.
+func (gw *Gateway) updateHealthScores() {
+	type sample struct {
+		ep        *types.RpcEndpoint
+		reachable bool
+		latency   time.Duration
+		block     int64
+	}
+	endpoints := gw.endpoints()
+	samples := make([]sample, len(endpoints))
+	var highestBlock int64 = -1
+	var latencies []time.Duration
+	for i, ep := range endpoints {
+		ep.Mutex.RLock()
+		samples[i] = sample{ep: ep, reachable: ep.IsReachable, latency: ep.Latency, block: ep.BlockNumber}
+		ep.Mutex.RUnlock()
+		if samples[i].reachable {
+			latencies = append(latencies, samples[i].latency)
+			if gw.tracksBlocks(ep) {
+				highestBlock = max(highestBlock, samples[i].block)
+			}
+		}
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	cfg := gw.config.HealthScore
+	w := cfg.Weights
+	totalWeight := w.Reachability + w.Latency + w.BlockLag + w.ErrorRate + w.RateLimit
+
+	for _, s := range samples {
+		var reachability, latency, blockLag float64
+		if s.reachable {
+			reachability = 1
+			if len(latencies) == 1 {
+				latency = 1
+			} else {
+				slower := len(latencies) - sort.Search(len(latencies), func(i int) bool { return latencies[i] > s.latency })
+				latency = float64(slower) / float64(len(latencies)-1)
+			}
+			blockLag = 1 // Unknown for plain HTTP checks, which are not held to it
+			if gw.tracksBlocks(s.ep) {
+				lag := highestBlock - s.block
+				blockLag = math.Max(0, 1-float64(lag)/float64(cfg.MaxBlockLag))
+			}
+		}
+
+		s.ep.Mutex.Lock()
+		errorRate := 1 - s.ep.ErrorRate
+		rateLimit := 1.0
+		switch {
+		case s.ep.IsRateLimited || s.ep.HasCredentialError:
+			rateLimit = 0
+		case isQuotaLow(s.ep):
+			rateLimit = 0.5
+		}
+
+		score := 0.0
+		if totalWeight > 0 {
+			score = 100 * (w.Reachability*reachability + w.Latency*latency + w.BlockLag*blockLag +
+				w.ErrorRate*errorRate + w.RateLimit*rateLimit) / totalWeight
+		}
+		s.ep.HealthScore = math.Round(score*10) / 10
+		s.ep.Mutex.Unlock()
+
+		metrics.RpcEndpointHealthScore.WithLabelValues(s.ep.URL.String()).Set(score)
+	}
+}
+
+// endpointStatus is the JSON view of an endpoint served by /endpoints.
+type endpointStatus struct {
+	URL             string  `json:"url"`
+	Region          string  `json:"region,omitempty"`
+	Priority        int     `json:"priority,omitempty"`
+	HealthScore     float64 `json:"healthScore"`
+	IsCurrentBest   bool    `json:"isCurrentBest"`
+	Rank            int     `json:"rank,omitempty"` // Position in the last ranking from 1, absent when not ranked
+	IsReachable     bool    `json:"isReachable"`
+	IsSyncing       bool    `json:"isSyncing"`
+	BlockNumber     int64   `json:"blockNumber"`
+	LatencyMs       float64 `json:"latencyMs"`
+	LatencyEWMAMs   float64 `json:"latencyEwmaMs"`
+	ErrorRate       float64 `json:"errorRate"`
+	RpcErrorRate    float64 `json:"rpcErrorRate"`
+	UptimePercent   float64 `json:"uptimePercent"`
+	EffectiveWeight float64 `json:"effectiveWeight"`
+	IsRateLimited   bool    `json:"isRateLimited"`
+	CredentialError bool    `json:"credentialError"`
+	QuotaRemaining  *int64  `json:"quotaRemaining,omitempty"`
+	ChainID         int64   `json:"chainId,omitempty"`
+	CircuitOpen     bool    `json:"circuitOpen"`
+	BlockOutlier    bool    `json:"blockOutlier"`
+	BlockStale      bool    `json:"blockStale"`
+	ErrorDemoted    bool    `json:"errorDemoted"`
+}
+
+// EndpointsHandler serves the state and health score of every endpoint as JSON.
+func (gw *Gateway) EndpointsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranked := gw.GetRankedEndpoints()
+		best := gw.GetBestEndpoint()
+		endpoints := gw.endpoints()
+		statuses := make([]endpointStatus, 0, len(endpoints))
+		for _, ep := range endpoints {
+			ep.Mutex.RLock()
+			status := endpointStatus{
+				URL:             ep.URL.String(),
+				Region:          ep.Config.Region,
+				Priority:        ep.Config.Priority,
+				HealthScore:     ep.HealthScore,
+				IsCurrentBest:   ep == best,
+				Rank:            slices.Index(ranked, ep) + 1,
+				IsReachable:     ep.IsReachable,
+				IsSyncing:       ep.IsSyncing,
+				BlockNumber:     ep.BlockNumber,
+				LatencyMs:       float64(ep.Latency.Microseconds()) / 1000,
+				LatencyEWMAMs:   float64(ep.LatencyEWMA.Microseconds()) / 1000,
+				ErrorRate:       math.Round(ep.ErrorRate*1000) / 1000,
+				RpcErrorRate:    math.Round(ep.RpcErrorRate*1000) / 1000,
+				UptimePercent:   math.Round(ep.UptimeRatio*1000) / 10,
+				EffectiveWeight: math.Round(ep.EffectiveWeight*1000) / 1000,
+				IsRateLimited:   ep.IsRateLimited,
+				CredentialError: ep.HasCredentialError,
+				ChainID:         ep.ChainID,
+				CircuitOpen:     !ep.CircuitOpenUntil.IsZero(),
+				BlockOutlier:    ep.BlockOutlier,
+				BlockStale:      ep.BlockStale,
+				ErrorDemoted:    ep.RpcErrorDemoted,
+			}
+			if ep.QuotaRemaining >= 0 {
+				quota := ep.QuotaRemaining
+				status.QuotaRemaining = &quota
+			}
+			ep.Mutex.RUnlock()
+			statuses = append(statuses, status)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(statuses)
+	})
+}
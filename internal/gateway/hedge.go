@@ -0,0 +1,142 @@
+package gateway
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"rpc-load-balancer/internal/metrics"
+	"rpc-load-balancer/internal/types"
+	"time"
+)
+
+// attempt is the outcome of one upstream round trip of a hedged request.
+type attempt struct {
+	endpoint *types.RpcEndpoint
+	resp     *http.Response
+	err      error
+	cancel   context.CancelFunc
+}
+
+// canHedge reports whether the request may be sent to a second endpoint: hedging
+// must be on, the body must be replayable and no call may have side effects.
+func (gw *Gateway) canHedge(req *http.Request, state *requestState) bool {
+	if !gw.config.Hedging.Enabled || state.endpoint.Config.HedgeDelay <= 0 {
+		return false
+	}
+	return canResend(req, state)
+}
+
+// roundTripHedged sends req to the request's endpoint and, if no response
+// headers arrive within its hedge delay, also to next. The first successful
+// response wins and the other attempt is cancelled.
+func (gw *Gateway) roundTripHedged(req *http.Request, state *requestState, next *types.RpcEndpoint) (*http.Response, error) {
+	primary := state.endpoint
+	primaryURL := primary.URL.String()
+	results := make(chan attempt, 2)
+
+	cancelPrimary := gw.startAttempt(req, primary, results)
+	timer := time.NewTimer(primary.Config.HedgeDelay)
+	defer timer.Stop()
+
+	var first attempt
+	select {
+	case first = <-results:
+		// Answered before the hedge delay
+		return gw.finishAttempt(first, state)
+	case <-timer.C:
+	}
+
+	log.Printf("🪃 [%s] %s slow to respond after %v, hedging to %s", state.requestID, primaryURL, primary.Config.HedgeDelay, next.URL.String())
+	hedge := req.Clone(req.Context())
+	resetEndpointHeaders(hedge.Header, primary, state.clientHeader)
+	gw.setUpstream(hedge, next, state.path)
+	if state.body != nil {
+		// Start from the client's body; the primary's may have been rewritten
+		hedge.Body = state.body.NewReader()
+		hedge.ContentLength = state.body.Len()
+		hedge.GetBody = nil
+	}
+	mapRequestMethods(hedge, next, state.payload)
+	cancelHedge := gw.startAttempt(hedge, next, results)
+
+	first = <-results
+	if first.err != nil {
+		// Fall back to whichever attempt is still running
+		second := <-results
+		if second.err == nil {
+			first, second = second, first
+		}
+		second.cancel()
+		if first.err != nil {
+			metrics.RpcHedgedRequestsTotal.WithLabelValues(primaryURL, "none").Inc()
+			return gw.finishAttempt(first, state)
+		}
+	} else {
+		// Abort the loser and release it once it returns
+		if first.endpoint == primary {
+			cancelHedge()
+		} else {
+			cancelPrimary()
+		}
+		go func() {
+			loser := <-results
+			if loser.resp != nil {
+				loser.resp.Body.Close()
+			}
+			loser.cancel()
+		}()
+	}
+
+	winner := "primary"
+	if first.endpoint != primary {
+		winner = "hedge"
+	}
+	metrics.RpcHedgedRequestsTotal.WithLabelValues(primaryURL, winner).Inc()
+	return gw.finishAttempt(first, state)
+}
+
+// startAttempt sends req to ep in the background with its own cancellable
+// context and delivers the outcome on results. It returns the cancel function
+// of that context. The attempt holds on to the buffered client body until the
+// transport closes the request body, as the losing attempt may still be
+// reading it after the request has been answered.
+func (gw *Gateway) startAttempt(req *http.Request, ep *types.RpcEndpoint, results chan<- attempt) context.CancelFunc {
+	ctx, cancel := context.WithCancel(req.Context())
+	req = req.WithContext(ctx)
+	state := stateFromContext(ctx)
+	if state.body != nil && req.Body != nil && req.Body != http.NoBody {
+		req.Body = state.body.retain(req.Body)
+	}
+	go func() {
+		chargeCalls(ep, state.callCount())
+		resp, err := gw.transportFor(ep).RoundTrip(req)
+		results <- attempt{endpoint: ep, resp: resp, err: err, cancel: cancel}
+	}()
+	return cancel
+}
+
+// finishAttempt records the answering endpoint on the request state and ties
+// the attempt's context to the response body.
+func (gw *Gateway) finishAttempt(a attempt, state *requestState) (*http.Response, error) {
+	if a.err != nil {
+		a.cancel()
+		return nil, a.err
+	}
+	state.endpoint = a.endpoint
+	a.resp.Body = &cancelOnClose{ReadCloser: a.resp.Body, cancel: a.cancel}
+	return a.resp, nil
+}
+
+// cancelOnClose cancels a request context once its response body is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close implements io.Closer.
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
@@ -0,0 +1,334 @@
+package gateway
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"rpc-load-balancer/internal/metrics"
+	"rpc-load-balancer/internal/types"
+	"strconv"
+)
+
+// Standard JSON-RPC 2.0 error codes.
+const (
+	rpcCodeParseError     = -32700
+	rpcCodeInvalidRequest = -32600
+	rpcCodeMethodNotFound = -32601
+	rpcCodeInvalidParams  = -32602
+	rpcCodeInternalError  = -32603
+	rpcCodeServerError    = -32000 // Start of the implementation-defined range
+	rpcCodeLimitExceeded  = -32005 // EIP-1474 "limit exceeded"
+)
+
+// rpcPayload is a parsed JSON-RPC request body, either a single call or a batch.
+type rpcPayload struct {
+	Calls   []types.JsonRpcRequest
+	IsBatch bool
+}
+
+// errInvalidBatch wraps the reason a JSON array body is not a valid batch.
+var errInvalidBatch = errors.New("invalid batch")
+
+// parseRpcPayload parses a request body as a single JSON-RPC call or a batch.
+// It decodes from a stream so spilled bodies need not be read into one slice.
+// Bodies that start as an array but are not a non-empty list of calls with a
+// method fail with errInvalidBatch.
+func parseRpcPayload(body io.Reader) (*rpcPayload, error) {
+	br := bufio.NewReader(body)
+	first, err := peekNonSpace(br)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(br)
+	if first == '[' {
+		var calls []types.JsonRpcRequest
+		if err := dec.Decode(&calls); err != nil {
+			return nil, fmt.Errorf("%w: %w", errInvalidBatch, err)
+		}
+		if len(calls) == 0 {
+			return nil, fmt.Errorf("%w: empty batch", errInvalidBatch)
+		}
+		for i, call := range calls {
+			if call.Method == "" {
+				return nil, fmt.Errorf("%w: call %d has no method", errInvalidBatch, i)
+			}
+		}
+		return &rpcPayload{Calls: calls, IsBatch: true}, nil
+	}
+
+	var call types.JsonRpcRequest
+	if err := dec.Decode(&call); err != nil {
+		return nil, err
+	}
+	return &rpcPayload{Calls: []types.JsonRpcRequest{call}}, nil
+}
+
+// peekNonSpace skips leading JSON whitespace and returns the next byte
+// without consuming it.
+func peekNonSpace(br *bufio.Reader) (byte, error) {
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		switch b {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+		return b, br.UnreadByte()
+	}
+}
+
+// methodLabel returns the bounded metric label for the payload's method.
+func methodLabel(payload *rpcPayload) string {
+	switch {
+	case payload == nil || len(payload.Calls) == 0:
+		return metrics.MethodLabelNone
+	case payload.IsBatch:
+		return metrics.MethodLabelBatch
+	default:
+		return metrics.MethodLabel(payload.Calls[0].Method)
+	}
+}
+
+// methods returns the method names of all calls in the payload, or nil when
+// there is no payload.
+func (p *rpcPayload) methods() []string {
+	if p == nil {
+		return nil
+	}
+	names := make([]string, len(p.Calls))
+	for i, call := range p.Calls {
+		names[i] = call.Method
+	}
+	return names
+}
+
+// mapMethods re-encodes the payload with its method names renamed through
+// mapping. It returns false when no call uses a mapped method.
+func (p *rpcPayload) mapMethods(mapping map[string]string) ([]byte, bool) {
+	mapped := &rpcPayload{Calls: make([]types.JsonRpcRequest, len(p.Calls)), IsBatch: p.IsBatch}
+	changed := false
+	for i, call := range p.Calls {
+		if to, ok := mapping[call.Method]; ok {
+			call.Method = to
+			changed = true
+		}
+		mapped.Calls[i] = call
+	}
+	if !changed {
+		return nil, false
+	}
+
+	body, err := mapped.encode()
+	if err != nil {
+		return nil, false
+	}
+	return body, true
+}
+
+// encode serializes the payload back into a request body.
+func (p *rpcPayload) encode() ([]byte, error) {
+	if p.IsBatch {
+		return json.Marshal(p.Calls)
+	}
+	return json.Marshal(p.Calls[0])
+}
+
+// writeMethods change state upstream, so requests containing them are never
+// sent to more than one endpoint.
+var writeMethods = map[string]bool{
+	"eth_sendRawTransaction": true,
+	"eth_sendTransaction":    true,
+}
+
+// hasWriteCall reports whether any call in the payload has side effects.
+func (p *rpcPayload) hasWriteCall() bool {
+	for _, call := range p.Calls {
+		if writeMethods[call.Method] {
+			return true
+		}
+	}
+	return false
+}
+
+// isNotification reports whether the call has no id and so expects no response.
+// An explicit "id": null is a regular call, not a notification.
+func isNotification(call types.JsonRpcRequest) bool {
+	return call.ID == nil
+}
+
+// notificationCount returns how many calls in the payload are notifications.
+func (p *rpcPayload) notificationCount() int {
+	count := 0
+	for _, call := range p.Calls {
+		if isNotification(call) {
+			count++
+		}
+	}
+	return count
+}
+
+// idKey normalizes a raw JSON-RPC id so equal ids compare equal as strings.
+func idKey(id json.RawMessage) string {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, id); err != nil {
+		return string(id)
+	}
+	return buf.String()
+}
+
+// stripNotificationResponses removes upstream replies to notifications from a
+// successful response. A lone notification, or a batch made up only of
+// notifications, is answered with an empty 204.
+func stripNotificationResponses(resp *http.Response, payload *rpcPayload) error {
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil
+	}
+	notifications := payload.notificationCount()
+	if notifications == 0 {
+		return nil
+	}
+
+	if notifications == len(payload.Calls) {
+		resp.Body.Close()
+		resp.StatusCode = http.StatusNoContent
+		resp.Status = "204 No Content"
+		resp.Body = http.NoBody
+		resp.ContentLength = 0
+		resp.Header.Del("Content-Length")
+		resp.Header.Del("Content-Type")
+		return nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	var entries []json.RawMessage
+	if err := json.Unmarshal(body, &entries); err != nil {
+		// Not a batch response (e.g. a single error object); pass it through.
+		replaceBody(resp, body)
+		return nil
+	}
+
+	// Count expected replies per id, so a sloppy upstream answering a
+	// notification with "id": null cannot displace a genuine null-id reply.
+	wanted := make(map[string]int, len(payload.Calls))
+	for _, call := range payload.Calls {
+		if !isNotification(call) {
+			wanted[idKey(call.ID)]++
+		}
+	}
+
+	kept := make([]json.RawMessage, 0, len(entries))
+	for _, entry := range entries {
+		var reply struct {
+			ID json.RawMessage `json:"id"`
+		}
+		if err := json.Unmarshal(entry, &reply); err != nil || reply.ID == nil {
+			continue
+		}
+		if key := idKey(reply.ID); wanted[key] > 0 {
+			wanted[key]--
+			kept = append(kept, entry)
+		}
+	}
+
+	filtered, err := json.Marshal(kept)
+	if err != nil {
+		return err
+	}
+	replaceBody(resp, filtered)
+	return nil
+}
+
+// replaceBody swaps the response body and keeps the length headers consistent.
+func replaceBody(resp *http.Response, body []byte) {
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	resp.Header.Del("Transfer-Encoding")
+}
+
+// normalizeResponse adds a missing or wrong "jsonrpc": "2.0" member to every
+// reply of a successful response and echoes the request id into replies
+// without one. Batch replies lacking an id are matched to the calls by
+// position, which is only done when the batch has one reply per call.
+// Compressed bodies and non-JSON bodies are passed through untouched.
+func (gw *Gateway) normalizeResponse(resp *http.Response, payload *rpcPayload) error {
+	if resp.StatusCode < 200 || resp.StatusCode > 299 || resp.Body == http.NoBody {
+		return nil
+	}
+	if enc := resp.Header.Get("Content-Encoding"); enc != "" && enc != "identity" {
+		return nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	var ids []json.RawMessage
+	for _, call := range payload.Calls {
+		if !isNotification(call) {
+			ids = append(ids, call.ID)
+		}
+	}
+
+	var entries []json.RawMessage
+	batch := payload.IsBatch && json.Unmarshal(body, &entries) == nil
+	if !batch {
+		entries = []json.RawMessage{body}
+	}
+	if len(entries) != len(ids) {
+		ids = nil // Cannot tell which call a reply without an id belongs to
+	}
+
+	changed := false
+	for i, entry := range entries {
+		var reply map[string]json.RawMessage
+		if err := json.Unmarshal(entry, &reply); err != nil {
+			continue
+		}
+		fixed := false
+		if version, ok := reply["jsonrpc"]; !ok || string(version) != `"2.0"` {
+			reply["jsonrpc"] = json.RawMessage(`"2.0"`)
+			fixed = true
+		}
+		if _, ok := reply["id"]; !ok && ids != nil {
+			reply["id"] = ids[i]
+			fixed = true
+		}
+		if !fixed {
+			continue
+		}
+		if entries[i], err = json.Marshal(reply); err != nil {
+			return err
+		}
+		changed = true
+	}
+	if !changed {
+		replaceBody(resp, body)
+		return nil
+	}
+
+	metrics.RpcNormalizedResponsesTotal.WithLabelValues(gw.chain).Inc()
+	if batch {
+		body, err = json.Marshal(entries)
+		if err != nil {
+			return err
+		}
+	} else {
+		body = entries[0]
+	}
+	replaceBody(resp, body)
+	return nil
+}
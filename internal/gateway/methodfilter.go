@@ -0,0 +1,55 @@
+package gateway
+
+import (
+	"rpc-load-balancer/internal/config"
+	"rpc-load-balancer/internal/metrics"
+	"rpc-load-balancer/internal/types"
+)
+
+// filteringMethods reports whether methodFilter restricts any methods.
+func (gw *Gateway) filteringMethods() bool {
+	filter := gw.config.MethodFilter
+	return len(filter.Allow) > 0 || len(filter.Deny) > 0
+}
+
+// methodAllowed reports whether methodFilter lets calls to method through.
+func (gw *Gateway) methodAllowed(method string) bool {
+	filter := gw.config.MethodFilter
+	if len(filter.Allow) > 0 && !matchesAnyMethod(filter.Allow, method) {
+		return false
+	}
+	return !matchesAnyMethod(filter.Deny, method)
+}
+
+// filterMethods checks the calls of the request against methodFilter. It
+// returns the first denied method and true when the request must be refused
+// as a whole: a single call, or a batch with methodFilter.batch "reject". In
+// "filter" mode the denied calls of a batch are moved from the payload to
+// state.denied instead, to be answered with an error while the rest is
+// forwarded.
+func (gw *Gateway) filterMethods(state *requestState) (string, bool) {
+	filter := gw.config.MethodFilter
+	payload := state.payload
+	var allowed, denied []types.JsonRpcRequest
+	for _, call := range payload.Calls {
+		if gw.methodAllowed(call.Method) {
+			allowed = append(allowed, call)
+			continue
+		}
+		metrics.RpcDeniedMethodCallsTotal.WithLabelValues(metrics.MethodLabel(call.Method), gw.chain).Inc()
+		if !payload.IsBatch || filter.Batch == config.BatchDeniedReject {
+			return call.Method, true
+		}
+		denied = append(denied, call)
+	}
+	if len(denied) == 0 {
+		return "", false
+	}
+	state.unfiltered = payload
+	state.payload = &rpcPayload{Calls: allowed, IsBatch: true}
+	state.denied = &batchPart{
+		calls: denied,
+		err:   &types.JsonRpcError{Code: rpcCodeMethodNotFound, Message: "method not allowed"},
+	}
+	return "", false
+}
@@ -0,0 +1,96 @@
+package gateway
+
+import (
+	"rpc-load-balancer/internal/config"
+	"rpc-load-balancer/internal/ratelimit"
+	"strings"
+)
+
+// methodLimiter enforces a single methodRateLimits entry. A "namespace_*"
+// pattern shares one budget across all the methods it matches.
+type methodLimiter struct {
+	pattern string
+	perIP   bool
+	limiter *ratelimit.Limiter
+}
+
+// newMethodLimiters builds a limiter for every configured method or pattern.
+func newMethodLimiters(limits map[string]config.MethodRateLimit) map[string]*methodLimiter {
+	limiters := make(map[string]*methodLimiter, len(limits))
+	for pattern, limit := range limits {
+		limiters[pattern] = &methodLimiter{
+			pattern: pattern,
+			perIP:   limit.PerIP,
+			limiter: ratelimit.New(limit.RequestsPerSecond, limit.Burst),
+		}
+	}
+	return limiters
+}
+
+// methodLimiterFor returns the limiter that applies to method: an exact entry
+// wins over the longest matching "prefix*" pattern. It returns nil if the
+// method is not limited.
+func (gw *Gateway) methodLimiterFor(method string) *methodLimiter {
+	if ml, ok := gw.methodLimiters[method]; ok {
+		return ml
+	}
+	var best *methodLimiter
+	for pattern, ml := range gw.methodLimiters {
+		prefix, isWildcard := strings.CutSuffix(pattern, "*")
+		if isWildcard && strings.HasPrefix(method, prefix) && (best == nil || len(pattern) > len(best.pattern)) {
+			best = ml
+		}
+	}
+	return best
+}
+
+// checkMethodLimits takes a token for every call in the payload and returns
+// the pattern of the first limit that was exceeded, or false if all calls
+// may proceed. A rejected payload consumes no tokens: the tokens of each
+// limit are reserved together and returned when a later limit rejects.
+func (gw *Gateway) checkMethodLimits(payload *rpcPayload, clientIP string) (string, bool) {
+	if len(gw.methodLimiters) == 0 {
+		return "", false
+	}
+	type bucketKey struct {
+		ml  *methodLimiter
+		key string
+	}
+	type bucketCalls struct {
+		bucketKey
+		calls int
+	}
+	var buckets []*bucketCalls // In order of the first call, to report the first limit
+	byKey := make(map[bucketKey]*bucketCalls)
+	for _, call := range payload.Calls {
+		ml := gw.methodLimiterFor(call.Method)
+		if ml == nil {
+			continue
+		}
+		key := ml.pattern
+		if ml.perIP {
+			key = clientIP + "|" + ml.pattern
+		}
+		bk := bucketKey{ml: ml, key: key}
+		bc, ok := byKey[bk]
+		if !ok {
+			bc = &bucketCalls{bucketKey: bk}
+			byKey[bk] = bc
+			buckets = append(buckets, bc)
+		}
+		bc.calls++
+	}
+
+	reservations := make([]*ratelimit.Reservation, 0, len(buckets))
+	for _, bc := range buckets {
+		reservation, ok := bc.ml.limiter.Reserve(bc.key, bc.calls)
+		if !ok {
+			for _, taken := range reservations {
+				taken.Cancel()
+			}
+			return bc.ml.pattern, true
+		}
+		reservations = append(reservations, reservation)
+	}
+	return "", false
+}
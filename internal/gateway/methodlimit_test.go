@@ -0,0 +1,55 @@
+package gateway
+
+import (
+	"rpc-load-balancer/internal/types"
+	"testing"
+)
+
+func TestCheckMethodLimitsRejectsWholeBatch(t *testing.T) {
+	upstream := newTestUpstream(t, nil)
+	gw := newTestGateway(t, `
+methodRateLimits:
+  eth_getLogs:
+    requestsPerSecond: 0.001
+    burst: 2
+  eth_call:
+    requestsPerSecond: 0.001
+    burst: 1
+  "debug_*":
+    requestsPerSecond: 0.001
+    burst: 1
+    perIP: true
+`, upstream.URL)
+	batch := func(methods ...string) *rpcPayload {
+		payload := &rpcPayload{IsBatch: len(methods) > 1}
+		for _, method := range methods {
+			payload.Calls = append(payload.Calls, types.JsonRpcRequest{Method: method})
+		}
+		return payload
+	}
+
+	tests := []struct {
+		name        string
+		payload     *rpcPayload
+		ip          string
+		wantPattern string
+		wantLimited bool
+	}{
+		// The eth_getLogs token is returned when eth_call rejects the batch
+		{name: "batch over a later limit", payload: batch("eth_getLogs", "eth_call", "eth_call"), ip: "10.0.0.1", wantPattern: "eth_call", wantLimited: true},
+		{name: "full burst after rejection", payload: batch("eth_getLogs", "eth_getLogs"), ip: "10.0.0.1"},
+		{name: "burst exhausted", payload: batch("eth_getLogs"), ip: "10.0.0.1", wantPattern: "eth_getLogs", wantLimited: true},
+		// The debug_* token is returned when eth_call rejects the batch
+		{name: "per-IP batch over a later limit", payload: batch("debug_traceCall", "eth_call", "eth_call"), ip: "10.0.0.2", wantPattern: "eth_call", wantLimited: true},
+		{name: "per-IP token after rejection", payload: batch("debug_traceCall"), ip: "10.0.0.2"},
+		{name: "per-IP burst exhausted", payload: batch("debug_traceCall"), ip: "10.0.0.2", wantPattern: "debug_*", wantLimited: true},
+		{name: "per-IP burst of another client", payload: batch("debug_traceCall"), ip: "10.0.0.3"},
+		{name: "unlimited method", payload: batch("eth_blockNumber"), ip: "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		pattern, limited := gw.checkMethodLimits(tt.payload, tt.ip)
+		if pattern != tt.wantPattern || limited != tt.wantLimited {
+			t.Errorf("%s: checkMethodLimits() = (%q, %v), want (%q, %v)", tt.name, pattern, limited, tt.wantPattern, tt.wantLimited)
+		}
+	}
+}
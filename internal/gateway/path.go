@@ -0,0 +1,45 @@
+package gateway
+
+import (
+	"path"
+	"rpc-load-balancer/internal/config"
+	"strings"
+)
+
+// upstreamPath builds the path forwarded to an endpoint from the endpoint's
+// configured path and the path the client requested, according to mode.
+func upstreamPath(endpointPath, clientPath, mode string) string {
+	switch mode {
+	case config.PathModeClean:
+		return cleanPath(endpointPath, false)
+	case config.PathModeAppend:
+		return joinPath(cleanPath(endpointPath, false), cleanPath(clientPath, strings.HasSuffix(clientPath, "/")))
+	case config.PathModePreserve:
+		return joinPath(endpointPath, clientPath)
+	default: // config.PathModeReplace
+		return endpointPath
+	}
+}
+
+// cleanPath collapses repeated slashes and resolves "." and ".." segments.
+// The result always starts with "/" and ends with one only if keepTrailing
+// is set and the path is not the root.
+func cleanPath(p string, keepTrailing bool) string {
+	cleaned := path.Clean("/" + p)
+	if keepTrailing && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// joinPath joins base and suffix with exactly one slash between them,
+// leaving the rest of both paths untouched.
+func joinPath(base, suffix string) string {
+	if suffix == "" || suffix == "/" {
+		if base == "" {
+			return "/"
+		}
+		return base
+	}
+	return strings.TrimRight(base, "/") + "/" + strings.TrimLeft(suffix, "/")
+}
@@ -0,0 +1,24 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/pprof"
+)
+
+// PprofHandler serves the runtime profiles of net/http/pprof under
+// /debug/pprof/. With an adminToken set, requests must carry it as a bearer
+// token, since profiles expose the process's internals.
+func PprofHandler(adminToken string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if adminToken != "" && !checkBearerToken(w, r, adminToken) {
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,49 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// HealthyEndpointCount returns the number of endpoints that can serve
+// requests right now, from their live health state.
+func (gw *Gateway) HealthyEndpointCount() int {
+	healthy := 0
+	for _, ep := range gw.endpoints() {
+		if gw.servable(ep) {
+			healthy++
+		}
+	}
+	return healthy
+}
+
+// LivenessHandler answers 200 as long as the process serves HTTP.
+func LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte("ok\n"))
+	})
+}
+
+// ReadinessHandler answers 200 when every gateway, keyed by chain name, has
+// a healthy endpoint, and 503 otherwise. The body has the healthy endpoint
+// count, per chain for a multi-chain gateway.
+func ReadinessHandler(gateways map[string]*Gateway) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ready := true
+		chains := make(map[string]int, len(gateways))
+		for name, gw := range gateways {
+			chains[name] = gw.HealthyEndpointCount()
+			ready = ready && chains[name] > 0
+		}
+		status := map[string]any{"ready": ready, "chains": chains}
+		if healthy, single := chains[""]; single {
+			status = map[string]any{"ready": ready, "healthyEndpoints": healthy}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if !ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(status)
+	})
+}
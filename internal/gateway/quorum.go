@@ -0,0 +1,82 @@
+package gateway
+
+import (
+	"log"
+	"rpc-load-balancer/internal/metrics"
+	"rpc-load-balancer/internal/types"
+	"slices"
+)
+
+// applyBlockQuorum guards the reference height against a buggy or
+// compromised upstream reporting a bogus future block. It returns the highest
+// block that at least blockQuorum candidates agree on within blockTolerance,
+// and the candidates without outliers: endpoints reporting a block more than
+// blockTolerance beyond it. Without such a quorum, candidates and
+// highestBlock are returned unchanged. Partial passes only filter; outlier
+// flags, metrics and logs are left to the complete pass.
+func (gw *Gateway) applyBlockQuorum(candidates []*types.RpcEndpoint, highestBlock int64, partial bool) ([]*types.RpcEndpoint, int64) {
+	quorum := gw.config.BlockQuorum
+	tolerance := gw.config.BlockTolerance
+
+	var blocks []int64
+	for _, ep := range candidates {
+		ep.Mutex.RLock()
+		if gw.tracksBlocks(ep) {
+			blocks = append(blocks, ep.BlockNumber)
+		}
+		ep.Mutex.RUnlock()
+	}
+	slices.Sort(blocks)
+	slices.Reverse(blocks)
+
+	reference := int64(-1)
+	for i, block := range blocks {
+		agreeing := 0
+		for _, b := range blocks[i:] {
+			if block-b > tolerance {
+				break
+			}
+			agreeing++
+		}
+		if agreeing >= quorum {
+			reference = block
+			break
+		}
+	}
+	if reference < 0 {
+		if !partial {
+			log.Printf("⚠️ Fewer than %d endpoints agree on a block height within %d blocks. Using the highest block without a quorum.", quorum, tolerance)
+		}
+		return candidates, highestBlock
+	}
+
+	kept := make([]*types.RpcEndpoint, 0, len(candidates))
+	for _, ep := range candidates {
+		ep.Mutex.RLock()
+		block := ep.BlockNumber
+		outlier := gw.tracksBlocks(ep) && block > reference+tolerance
+		ep.Mutex.RUnlock()
+		if !outlier {
+			kept = append(kept, ep)
+		}
+		if partial {
+			continue
+		}
+
+		ep.Mutex.Lock()
+		flagged := ep.BlockOutlier
+		ep.BlockOutlier = outlier
+		ep.Mutex.Unlock()
+		endpointURL := ep.URL.String()
+		switch {
+		case outlier:
+			metrics.RpcEndpointOutlierTotal.WithLabelValues(endpointURL).Inc()
+			if !flagged {
+				log.Printf("🚩 %s reports block %d, ahead of block %d agreed by at least %d endpoints. Excluding it as an outlier.", endpointURL, block, reference, quorum)
+			}
+		case flagged:
+			log.Printf("🏳️ %s is back in line with the quorum at block %d.", endpointURL, block)
+		}
+	}
+	return kept, reference
+}
@@ -0,0 +1,37 @@
+package gateway
+
+import (
+	"net/http"
+	"rpc-load-balancer/internal/metrics"
+	"rpc-load-balancer/internal/types"
+	"strconv"
+	"strings"
+)
+
+// updateQuota records the remaining request quota reported by the upstream in
+// the endpoint's configured quota header. It returns true when the endpoint
+// has just crossed into the low-quota zone.
+// The caller must hold ep.Mutex for writing.
+func updateQuota(ep *types.RpcEndpoint, header http.Header) bool {
+	raw := header.Get(ep.Config.QuotaRemainingHeader)
+	if raw == "" {
+		return false
+	}
+	remaining, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+	if err != nil {
+		return false
+	}
+
+	wasLow := isQuotaLow(ep)
+	ep.QuotaRemaining = remaining
+	metrics.RpcEndpointQuotaRemaining.WithLabelValues(ep.URL.String()).Set(float64(remaining))
+	return !wasLow && isQuotaLow(ep)
+}
+
+// isQuotaLow reports whether the endpoint is close to exhausting its quota.
+// Endpoints without a threshold or without a reported quota are never low.
+// The caller must hold ep.Mutex for reading.
+func isQuotaLow(ep *types.RpcEndpoint) bool {
+	threshold := ep.Config.QuotaLowThreshold
+	return threshold > 0 && ep.QuotaRemaining >= 0 && ep.QuotaRemaining <= threshold
+}
@@ -0,0 +1,31 @@
+package gateway
+
+import (
+	"math/rand/v2"
+	"rpc-load-balancer/internal/types"
+	"time"
+)
+
+// markRateLimited backs the endpoint off after a rate limit and returns the
+// backoff. Each consecutive rate limit doubles rateLimitBackoff, up to
+// rateLimitBackoffMax, and up to a fifth is added at random so that endpoints
+// limited together do not all come back at once. A rate limit during a
+// running backoff, such as from requests already in flight, leaves it as
+// is. The caller must hold ep.Mutex for writing.
+func (gw *Gateway) markRateLimited(ep *types.RpcEndpoint, now time.Time) time.Duration {
+	if ep.IsRateLimited && now.Before(ep.RateLimitedUntil) {
+		return ep.RateLimitedUntil.Sub(now)
+	}
+	backoff := gw.config.RateLimitBackoff
+	for i := 0; i < ep.RateLimitStreak && backoff < gw.config.RateLimitBackoffMax; i++ {
+		backoff *= 2
+	}
+	backoff = min(backoff, gw.config.RateLimitBackoffMax)
+	if backoff > 0 {
+		backoff += rand.N(backoff/5 + 1)
+	}
+	ep.RateLimitStreak++
+	ep.IsRateLimited = true
+	ep.RateLimitedUntil = now.Add(backoff)
+	return backoff
+}
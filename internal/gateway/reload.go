@@ -0,0 +1,250 @@
+package gateway
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"reflect"
+	"rpc-load-balancer/internal/config"
+	"rpc-load-balancer/internal/metrics"
+	"rpc-load-balancer/internal/types"
+	"slices"
+)
+
+// endpointSet is the list of configured endpoints with the state derived from
+// it. It is never modified once published.
+type endpointSet struct {
+	all []*types.RpcEndpoint
+	// canary receives canary.percent of read-only traffic and is kept out
+	// of regular selection; nil without a canary.
+	canary *types.RpcEndpoint
+	// variantPools holds the endpoints of each variant, nil without variants
+	variantPools map[string]map[*types.RpcEndpoint]bool
+	maxCost      float64 // Highest costPerRequest, the reference for costWeight
+}
+
+// newEndpointSet derives the canary and variant pools for endpoints.
+func (gw *Gateway) newEndpointSet(endpoints []*types.RpcEndpoint) *endpointSet {
+	set := &endpointSet{
+		all:          endpoints,
+		variantPools: newVariantPools(gw.config.Variants, endpoints),
+		maxCost:      maxCostPerRequest(endpoints),
+	}
+	for _, ep := range endpoints {
+		if gw.config.Canary.URL != "" && ep.Config.URL == gw.config.Canary.URL {
+			set.canary = ep
+		}
+	}
+	return set
+}
+
+// initial returns the endpoint to serve until a selection pass has run: the
+// first one that is not the canary.
+func (set *endpointSet) initial() *types.RpcEndpoint {
+	for _, ep := range set.all {
+		if ep != set.canary {
+			return ep
+		}
+	}
+	return set.all[0]
+}
+
+// endpoints returns the configured endpoints. The slice must not be modified.
+func (gw *Gateway) endpoints() []*types.RpcEndpoint {
+	return gw.endpointSet.Load().all
+}
+
+// newEndpoint creates the runtime state of a configured endpoint.
+func (gw *Gateway) newEndpoint(cfg *config.Config, epCfg config.EndpointConfig) (*types.RpcEndpoint, error) {
+	parsedURL, err := url.Parse(epCfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	var wsURL *url.URL
+	if epCfg.WsURL != "" {
+		if wsURL, err = url.Parse(epCfg.WsURL); err != nil {
+			return nil, err
+		}
+	}
+	headers := endpointHeaders(parsedURL, epCfg)
+	// The credentials travel in the Authorization header; the URL names
+	// the endpoint in metric labels and logs, so it must not carry them
+	parsedURL.User = nil
+	return &types.RpcEndpoint{
+		URL:             parsedURL,
+		WsURL:           wsURL,
+		QuotaRemaining:  -1,
+		PeerCount:       -1,
+		Outcomes:        types.NewOutcomeWindow(cfg.ErrorRateWindow),
+		RpcOutcomes:     types.NewOutcomeWindow(cfg.ErrorRateWindow),
+		Uptime:          types.NewUptimeWindow(cfg.Uptime.Window),
+		UptimeRatio:     1,
+		EffectiveWeight: epCfg.Weight,
+		Tags:            endpointTags(epCfg),
+		Config:          epCfg,
+		Headers:         headers,
+		Transport:       newEndpointTransport(gw.transport, epCfg, gw.config.ConnectTimeout),
+	}, nil
+}
+
+// endpointHeaders builds the headers set on every request to an endpoint
+// from its configured headers and basic auth credentials, taken from
+// basicAuth or else from the URL.
+func endpointHeaders(parsedURL *url.URL, epCfg config.EndpointConfig) http.Header {
+	header := make(http.Header, len(epCfg.Headers)+1)
+	for name, value := range epCfg.Headers {
+		header.Set(name, value)
+	}
+	req := &http.Request{Header: header}
+	if auth := epCfg.BasicAuth; auth != nil {
+		req.SetBasicAuth(auth.Username, auth.Password)
+	} else if user := parsedURL.User; user != nil {
+		password, _ := user.Password()
+		req.SetBasicAuth(user.Username(), password)
+	}
+	if len(header) == 0 {
+		return nil
+	}
+	return header
+}
+
+// redactURL returns a configured endpoint URL with any password replaced,
+// for log lines and errors. An unparseable URL is returned as is.
+func redactURL(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil {
+		return u.Redacted()
+	}
+	return rawURL
+}
+
+// publishEndpointMetrics sets the initial gauge values of a new endpoint.
+func publishEndpointMetrics(ep *types.RpcEndpoint, isBest bool) {
+	endpointURL := ep.URL.String()
+	metrics.RpcEndpointIsActive.WithLabelValues(endpointURL).Set(0)
+	best := metrics.RpcEndpointCurrentBestNotActive
+	if isBest {
+		best = metrics.RpcEndpointCurrentBestActive
+		setCurrentBestInfo(nil, ep)
+	}
+	metrics.RpcEndpointIsCurrentBest.WithLabelValues(endpointURL).Set(best)
+	metrics.RpcEndpointEffectiveWeight.WithLabelValues(endpointURL).Set(ep.EffectiveWeight)
+	metrics.RpcEndpointCircuitState.WithLabelValues(endpointURL).Set(metrics.CircuitClosed)
+}
+
+// ApplyConfig applies a reloaded configuration to the running gateway. The
+// endpoint list is diffed by URL: new endpoints are added, removed ones
+// dropped, and unchanged ones kept as they are. New endpoints must report the
+// chain ID of the others, see checkAddedChainID. An endpoint whose settings
+// changed is recreated with its health state carried over, which is also how
+// a changed requestTimeout reaches the health checks, through the
+// healthCheckTimeout it provides the default for. The check interval is
+// applied as well. Other settings only take effect on restart, apart from
+// the per-endpoint values they provide defaults for.
+func (gw *Gateway) ApplyConfig(cfg *config.Config) {
+	gw.endpointsMu.Lock()
+	defer gw.endpointsMu.Unlock()
+
+	old := gw.endpointSet.Load()
+	byURL := make(map[string]*types.RpcEndpoint, len(old.all))
+	for _, ep := range old.all {
+		byURL[ep.Config.URL] = ep
+	}
+
+	var endpoints []*types.RpcEndpoint
+	added, changed := 0, 0
+	for _, epCfg := range cfg.RpcEndpoints {
+		previous := byURL[epCfg.URL]
+		delete(byURL, epCfg.URL)
+		if previous != nil && reflect.DeepEqual(previous.Config, epCfg) {
+			endpoints = append(endpoints, previous)
+			continue
+		}
+		ep, err := gw.newEndpoint(cfg, epCfg)
+		if err != nil {
+			log.Printf("Warning: Skipping invalid endpoint URL %s: %v", epCfg.URL, err)
+			continue
+		}
+		if previous != nil {
+			carryOverState(previous, ep)
+			changed++
+		} else {
+			if err := gw.checkAddedChainID(ep, old.all); err != nil {
+				log.Printf("Warning: Skipping endpoint: %v", err)
+				continue
+			}
+			publishEndpointMetrics(ep, false)
+			added++
+		}
+		endpoints = append(endpoints, ep)
+	}
+	if len(endpoints) == 0 {
+		log.Println("⚠️ Reloaded configuration has no valid endpoints. Keeping the current ones.")
+		return
+	}
+
+	set := gw.newEndpointSet(endpoints)
+	gw.endpointSet.Store(set)
+	for _, ep := range byURL {
+		if ep.Transport != nil {
+			ep.Transport.CloseIdleConnections()
+		}
+		metrics.DeleteEndpoint(ep.URL.String())
+	}
+
+	// Drop removed and replaced endpoints from the ranking right away; the
+	// selection pass below ranks the new ones
+	var ranked []*types.RpcEndpoint
+	for _, ep := range gw.GetRankedEndpoints() {
+		if i := slices.IndexFunc(endpoints, func(e *types.RpcEndpoint) bool { return e.Config.URL == ep.Config.URL }); i >= 0 {
+			ranked = append(ranked, endpoints[i])
+		}
+	}
+	if len(ranked) == 0 {
+		ranked = []*types.RpcEndpoint{set.initial()}
+	}
+	gw.setRanking(ranked)
+	// Weighted balancing must not keep sending requests to removed endpoints
+	gw.updatePool(ranked[0], ranked)
+
+	select {
+	case <-gw.reloadInterval: // Replace an interval not yet picked up
+	default:
+	}
+	gw.reloadInterval <- cfg.CheckInterval
+
+	log.Printf("🔄 Configuration reloaded: %d endpoints (%d added, %d changed, %d removed)", len(endpoints), added, changed, len(byURL))
+	go gw.SelectBestEndpoint()
+}
+
+// carryOverState copies the health state of an endpoint to its replacement
+// with changed settings, so it does not start over as unchecked.
+func carryOverState(from, to *types.RpcEndpoint) {
+	from.Mutex.RLock()
+	defer from.Mutex.RUnlock()
+	to.BlockNumber = from.BlockNumber
+	to.Latency = from.Latency
+	to.LatencyEWMA = from.LatencyEWMA
+	to.IsReachable = from.IsReachable
+	to.IsSyncing = from.IsSyncing
+	to.BlockAdvancedAt = from.BlockAdvancedAt
+	to.BlockStale = from.BlockStale
+	to.IsRateLimited = from.IsRateLimited
+	to.RateLimitedUntil = from.RateLimitedUntil
+	to.RateLimitStreak = from.RateLimitStreak
+	to.HasCredentialError = from.HasCredentialError
+	to.CredentialRetryAt = from.CredentialRetryAt
+	to.ProxyFailures = from.ProxyFailures
+	to.CircuitOpenUntil = from.CircuitOpenUntil
+	to.PeerCount = from.PeerCount
+	to.ChainID = from.ChainID
+	to.TxReady = from.TxReady
+	to.QuotaRemaining = from.QuotaRemaining
+	to.HealthScore = from.HealthScore
+	to.ErrorRate = from.ErrorRate
+	to.Outcomes = from.Outcomes.Clone()
+	to.RpcErrorRate = from.RpcErrorRate
+	to.RpcOutcomes = from.RpcOutcomes.Clone()
+	to.RpcErrorDemoted = from.RpcErrorDemoted
+	to.Uptime = from.Uptime.Clone()
+	to.UptimeRatio = from.UptimeRatio
+}
@@ -0,0 +1,41 @@
+package gateway
+
+import (
+	"crypto/rand"
+	"fmt"
+)
+
+// requestIDHeader carries the ID that correlates a request across the
+// client, the gateway's log lines and the upstream.
+const requestIDHeader = "X-Request-Id"
+
+// maxRequestIDLength bounds client-supplied request IDs, which end up in
+// every log line of the request.
+const maxRequestIDLength = 128
+
+// newRequestID returns the client's request ID if it is usable, or a new
+// random UUID.
+func newRequestID(clientID string) string {
+	if validRequestID(clientID) {
+		return clientID
+	}
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40 // Version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// validRequestID reports whether id is non-empty, not overly long and made of
+// printable ASCII only, so it cannot break log lines.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,180 @@
+package gateway
+
+import (
+	"fmt"
+	"net/http"
+	"rpc-load-balancer/internal/config"
+	"rpc-load-balancer/internal/logging"
+	"rpc-load-balancer/internal/metrics"
+	"rpc-load-balancer/internal/types"
+	"slices"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// newRetryBudget creates the token bucket shared by all retries and
+// failovers, or returns nil when retryBudget is disabled.
+func newRetryBudget(cfg config.RetryBudgetConfig) *rate.Limiter {
+	if cfg.RetriesPerSecond == 0 {
+		return nil
+	}
+	return rate.NewLimiter(rate.Limit(cfg.RetriesPerSecond), cfg.Burst)
+}
+
+// spendRetry takes a token from the retry budget for one more attempt. When
+// the budget is exhausted it returns false and the failed attempt stands.
+func (gw *Gateway) spendRetry() bool {
+	if gw.retryBudget == nil || gw.retryBudget.Allow() {
+		return true
+	}
+	metrics.RpcRetryBudgetExhaustedTotal.WithLabelValues(gw.chain).Inc()
+	logging.Limitedf("🪣 Retry budget exhausted, not retrying")
+	return false
+}
+
+// canResend reports whether the request may be sent upstream more than once:
+// the body must be replayable and no call may have side effects.
+func canResend(req *http.Request, state *requestState) bool {
+	if req.Body != nil && req.Body != http.NoBody && state.body == nil {
+		return false
+	}
+	return state.payload == nil || !state.payload.hasWriteCall()
+}
+
+// roundTripWithRetries sends req to the request's endpoint, retrying failed
+// attempts as the endpoint's retry policy allows.
+func (gw *Gateway) roundTripWithRetries(req *http.Request, state *requestState) (*http.Response, error) {
+	ep := state.endpoint
+	policy := ep.Config.Retry
+	transport := gw.transportFor(ep)
+	if policy.Retries == 0 || !canResend(req, state) {
+		chargeCalls(ep, state.callCount())
+		return transport.RoundTrip(req)
+	}
+
+	endpointURL := ep.URL.String()
+	for attempt := 0; ; attempt++ {
+		chargeCalls(ep, state.callCount())
+		resp, err := transport.RoundTrip(req)
+		reason := retryReason(resp, err, policy.RetryableStatus)
+		if attempt > 0 {
+			outcome := "success"
+			if reason != "" {
+				outcome = "failure"
+			}
+			metrics.RpcProxyRetriesTotal.WithLabelValues(endpointURL, outcome).Inc()
+		}
+		if reason == "" || attempt == policy.Retries || req.Context().Err() != nil || !gw.spendRetry() {
+			return resp, err
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		logging.Limitedf("🔁 Retrying %s (%d/%d) after %s", endpointURL, attempt+1, policy.Retries, reason)
+		ep.Mutex.Lock()
+		gw.recordProxyOutcome(ep, true)
+		ep.Mutex.Unlock()
+
+		if policy.Delay > 0 {
+			timer := time.NewTimer(policy.Delay)
+			select {
+			case <-timer.C:
+			case <-req.Context().Done():
+				timer.Stop()
+				return nil, req.Context().Err()
+			}
+		}
+		if req, err = resendRequest(req, state); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// roundTripWithFailover sends req with the endpoint's retry policy and, once
+// that is exhausted, fails over to the next-best endpoints not tried yet, up
+// to failover.maxRetries times. The endpoint that answers becomes the
+// request's endpoint.
+func (gw *Gateway) roundTripWithFailover(req *http.Request, state *requestState) (*http.Response, error) {
+	resp, err := gw.roundTripWithRetries(req, state)
+	maxFailovers := gw.config.Failover.MaxRetries
+	if maxFailovers == 0 || !canResend(req, state) {
+		return resp, err
+	}
+
+	tried := map[*types.RpcEndpoint]bool{state.endpoint: true}
+	for failover := 1; failover <= maxFailovers; failover++ {
+		failed := state.endpoint
+		reason := retryReason(resp, err, failed.Config.Retry.RetryableStatus)
+		if reason == "" || req.Context().Err() != nil {
+			return resp, err
+		}
+		next := gw.nextBestEndpointWhere(nil, func(ep *types.RpcEndpoint) bool { return !tried[ep] })
+		if next == nil || !gw.spendRetry() {
+			return resp, err
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		logging.Limitedf("🔀 Failing over from %s to %s (%d/%d) after %s", failed.URL.String(), next.URL.String(), failover, maxFailovers, reason)
+		failed.Mutex.Lock()
+		gw.recordProxyOutcome(failed, true)
+		failed.Mutex.Unlock()
+
+		tried[next] = true
+		state.endpoint = next
+		if req, err = resendRequest(req, state); err != nil {
+			return nil, err
+		}
+		resetEndpointHeaders(req.Header, failed, state.clientHeader)
+		gw.setUpstream(req, next, state.path)
+		if state.body != nil {
+			// Start from the client's body; the failed endpoint's may have been rewritten
+			req.Body = state.body.NewReader()
+			req.ContentLength = state.body.Len()
+			req.GetBody = nil
+		}
+		mapRequestMethods(req, next, state.payload)
+
+		resp, err = gw.roundTripWithRetries(req, state)
+		outcome := "failover_success"
+		if retryReason(resp, err, next.Config.Retry.RetryableStatus) != "" {
+			outcome = "failover_failure"
+		}
+		metrics.RpcProxyRetriesTotal.WithLabelValues(next.URL.String(), outcome).Inc()
+	}
+	return resp, err
+}
+
+// retryReason describes why an attempt should be retried, or returns an
+// empty string if it succeeded or failed with a status not worth retrying.
+func retryReason(resp *http.Response, err error, retryable []int) string {
+	if err != nil {
+		return fmt.Sprintf("error: %v", err)
+	}
+	if slices.Contains(retryable, resp.StatusCode) {
+		return fmt.Sprintf("HTTP %d", resp.StatusCode)
+	}
+	return ""
+}
+
+// resendRequest clones req with a fresh copy of its body. A body rewritten for
+// the endpoint is replayed through GetBody, otherwise the buffered client body
+// is used.
+func resendRequest(req *http.Request, state *requestState) (*http.Request, error) {
+	next := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		next.Body = body
+	} else if state.body != nil {
+		next.Body = state.body.NewReader()
+	} else {
+		next.Body = http.NoBody
+	}
+	return next, nil
+}
@@ -0,0 +1,138 @@
+package gateway
+
+import (
+	"encoding/json"
+	"rpc-load-balancer/internal/config"
+	"rpc-load-balancer/internal/metrics"
+	"rpc-load-balancer/internal/types"
+	"strconv"
+	"strings"
+)
+
+// endpointTags builds the tag set of an endpoint from its configuration.
+func endpointTags(cfg config.EndpointConfig) map[string]bool {
+	tags := make(map[string]bool, len(cfg.Tags)+1)
+	for _, tag := range cfg.Tags {
+		tags[tag] = true
+	}
+	if cfg.Region != "" {
+		tags["region:"+cfg.Region] = true
+	}
+	return tags
+}
+
+// routingRuleFor returns the first routing rule matching a call of the
+// payload, or nil. The block age of rules with minBlockAge is measured from
+// the block of best.
+func (gw *Gateway) routingRuleFor(payload *rpcPayload, best *types.RpcEndpoint) *config.RoutingRule {
+	if payload == nil {
+		return nil
+	}
+	head := int64(-1)
+	for i := range gw.config.RoutingRules {
+		rule := &gw.config.RoutingRules[i]
+		for _, call := range payload.Calls {
+			if !matchesAnyMethod(rule.Methods, call.Method) {
+				continue
+			}
+			if rule.MinBlockAge == 0 {
+				return rule
+			}
+			if head < 0 && best != nil {
+				best.Mutex.RLock()
+				head = best.BlockNumber
+				best.Mutex.RUnlock()
+			}
+			if block, ok := callBlock(call); ok && head-block >= rule.MinBlockAge {
+				return rule
+			}
+		}
+	}
+	return nil
+}
+
+// callBlock returns the block a call refers to, and false when it names no
+// explicit block: no block parameter, a tag other than "earliest", or a block
+// hash. The block is the first parameter of the *ByNumber methods, else the
+// last one. For object parameters such as eth_getLogs filters the oldest of
+// their block fields counts.
+func callBlock(call types.JsonRpcRequest) (int64, bool) {
+	var params []json.RawMessage
+	if json.Unmarshal(call.Params, &params) != nil || len(params) == 0 {
+		return 0, false
+	}
+	param := params[len(params)-1]
+	if strings.Contains(call.Method, "ByNumber") || strings.Contains(call.Method, "ByBlockNumber") {
+		param = params[0]
+	}
+	if len(param) == 0 || param[0] != '{' {
+		return blockRef(param)
+	}
+
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(param, &fields) != nil {
+		return 0, false
+	}
+	oldest, found := int64(0), false
+	for _, name := range blockTagFields {
+		if block, ok := blockRef(fields[name]); ok && (!found || block < oldest) {
+			oldest, found = block, true
+		}
+	}
+	return oldest, found
+}
+
+// blockRef parses a block parameter holding a hex block number or
+// "earliest". Longer hex strings such as hashes and addresses do not count.
+func blockRef(raw json.RawMessage) (int64, bool) {
+	var s string
+	if json.Unmarshal(raw, &s) != nil {
+		return 0, false
+	}
+	if s == "earliest" {
+		return 0, true
+	}
+	if !isHexString(s) || len(s) > 2+15 { // 15 hex digits always fit an int64
+		return 0, false
+	}
+	block, err := strconv.ParseInt(s[2:], 16, 64)
+	return block, err == nil
+}
+
+// matchesAnyMethod reports whether method equals one of the patterns or
+// starts with the prefix of a "prefix*" pattern.
+func matchesAnyMethod(patterns []string, method string) bool {
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(method, prefix) {
+				return true
+			}
+		} else if pattern == method {
+			return true
+		}
+	}
+	return false
+}
+
+// taggedEndpoint returns best if its tags satisfy the rule, else the best
+// healthy endpoint that does. Without a match it returns best when the rule
+// allows falling back, else nil.
+func (gw *Gateway) taggedEndpoint(best *types.RpcEndpoint, rule *config.RoutingRule) *types.RpcEndpoint {
+	outcome := "matched"
+	defer func() {
+		metrics.RpcRoutingRuleRequestsTotal.WithLabelValues(rule.Match, outcome, gw.chain).Inc()
+	}()
+
+	if rule.Expr.Match(best.Tags) {
+		return best
+	}
+	if ep := gw.nextBestEndpointWhere(best, func(ep *types.RpcEndpoint) bool { return rule.Expr.Match(ep.Tags) }); ep != nil {
+		return ep
+	}
+	if rule.Fallback {
+		outcome = "fallback"
+		return best
+	}
+	outcome = "unmatched"
+	return nil
+}
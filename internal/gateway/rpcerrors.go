@@ -0,0 +1,127 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"rpc-load-balancer/internal/metrics"
+	"rpc-load-balancer/internal/types"
+)
+
+// rpcCodeExecutionReverted is the code nodes answer a reverted eth_call or
+// eth_estimateGas with.
+const rpcCodeExecutionReverted = 3
+
+// minRpcErrorSamples is the number of replies an endpoint must have in its
+// JSON-RPC error window before it can be demoted, so a few early errors do
+// not demote it.
+const minRpcErrorSamples = 20
+
+// maxInspectedResponseBytes bounds the responses searched for JSON-RPC
+// errors. Larger responses, such as big eth_getLogs results, are passed on
+// without being counted rather than buffered.
+const maxInspectedResponseBytes = 1 << 20
+
+// inspectRpcErrors counts the JSON-RPC replies and error replies in a
+// successful response and records them for the endpoint. The part of the
+// body read is put back in front of the rest, so the client receives the
+// response intact. Compressed, non-JSON and oversized bodies are not counted.
+func (gw *Gateway) inspectRpcErrors(resp *http.Response, ep *types.RpcEndpoint) error {
+	if resp.StatusCode < 200 || resp.StatusCode > 299 || resp.Body == http.NoBody ||
+		resp.ContentLength > maxInspectedResponseBytes {
+		return nil
+	}
+	if enc := resp.Header.Get("Content-Encoding"); enc != "" && enc != "identity" {
+		return nil
+	}
+	head, err := io.ReadAll(io.LimitReader(resp.Body, maxInspectedResponseBytes+1))
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(head), resp.Body), resp.Body}
+	if err != nil {
+		return err
+	}
+	if len(head) > maxInspectedResponseBytes {
+		return nil
+	}
+
+	errs, replies := countRpcErrors(head)
+	if replies == 0 {
+		return nil
+	}
+	ep.Mutex.Lock()
+	changed := false
+	for i := 0; i < replies; i++ {
+		changed = gw.recordRpcOutcome(ep, i < errs) || changed
+	}
+	ep.Mutex.Unlock()
+	if changed {
+		go gw.SelectBestEndpoint()
+	}
+	return nil
+}
+
+// countRpcErrors returns the number of error replies and of all replies in a
+// single or batch JSON-RPC response body. Errors caused by the call rather
+// than the endpoint, such as invalid params or a reverted call, count as
+// regular replies.
+func countRpcErrors(body []byte) (errs, replies int) {
+	var entries []json.RawMessage
+	if json.Unmarshal(body, &entries) != nil {
+		entries = []json.RawMessage{body}
+	}
+	for _, entry := range entries {
+		var reply struct {
+			Result json.RawMessage     `json:"result"`
+			Error  *types.JsonRpcError `json:"error"`
+		}
+		if json.Unmarshal(entry, &reply) != nil || reply.Result == nil && reply.Error == nil {
+			continue
+		}
+		replies++
+		if reply.Error != nil && !isCallError(reply.Error.Code) {
+			errs++
+		}
+	}
+	return errs, replies
+}
+
+// isCallError reports whether a JSON-RPC error code blames the call itself,
+// which any endpoint would have rejected.
+func isCallError(code int) bool {
+	switch code {
+	case rpcCodeParseError, rpcCodeInvalidRequest, rpcCodeInvalidParams, rpcCodeExecutionReverted:
+		return true
+	}
+	return false
+}
+
+// recordRpcOutcome adds a JSON-RPC reply to the endpoint's error window and
+// demotes the endpoint while its error rate exceeds maxErrorRate, or lifts
+// the demotion once it no longer does. It returns true when the demotion
+// changed. The caller must hold the write lock.
+func (gw *Gateway) recordRpcOutcome(ep *types.RpcEndpoint, failed bool) bool {
+	ep.RpcOutcomes.Add(failed)
+	ep.RpcErrorRate = ep.RpcOutcomes.Rate()
+	endpointURL := ep.URL.String()
+	metrics.RpcEndpointRpcErrorRate.WithLabelValues(endpointURL).Set(ep.RpcErrorRate)
+
+	maxRate := gw.config.MaxErrorRate
+	demoted := maxRate > 0 && ep.RpcErrorRate > maxRate &&
+		ep.RpcOutcomes.Len() >= min(minRpcErrorSamples, gw.config.ErrorRateWindow)
+	if demoted == ep.RpcErrorDemoted {
+		return false
+	}
+	ep.RpcErrorDemoted = demoted
+	if demoted {
+		log.Printf("📉 Demoting %s: JSON-RPC error rate %.2f exceeds %.2f", endpointURL, ep.RpcErrorRate, maxRate)
+		metrics.RpcEndpointErrorDemoted.WithLabelValues(endpointURL).Set(1)
+	} else {
+		log.Printf("📈 Lifting demotion of %s: JSON-RPC error rate back at %.2f", endpointURL, ep.RpcErrorRate)
+		metrics.RpcEndpointErrorDemoted.WithLabelValues(endpointURL).Set(0)
+	}
+	return true
+}
@@ -0,0 +1,174 @@
+package gateway
+
+import (
+	"math"
+	"rpc-load-balancer/internal/config"
+	"rpc-load-balancer/internal/metrics"
+	"rpc-load-balancer/internal/types"
+	"slices"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// candidateLess orders selection candidates: endpoints in the lowest
+// priority group first, then in the most preferred region, then those not
+// demoted for their JSON-RPC error rate, then those with quota to spare, then by latency divided by effective weight and scaled by
+// cost, with the configured tie-breaker last. The current best gets the
+// configured incumbency discount on its latency. The caller must hold both
+// read locks.
+func (gw *Gateway) candidateLess(a, b *types.RpcEndpoint) bool {
+	return gw.lessWithDiscount(a, b, gw.config.IncumbentDiscount)
+}
+
+// lessWithDiscount is candidateLess with an explicit incumbency discount.
+func (gw *Gateway) lessWithDiscount(a, b *types.RpcEndpoint, discount float64) bool {
+	if a.Config.Priority != b.Config.Priority {
+		return a.Config.Priority < b.Config.Priority
+	}
+	if rankA, rankB := gw.regionRank(a), gw.regionRank(b); rankA != rankB {
+		return rankA < rankB
+	}
+	// Endpoints answering too many calls with errors go after all others
+	if a.RpcErrorDemoted != b.RpcErrorDemoted {
+		return b.RpcErrorDemoted
+	}
+	// Endpoints close to exhausting their quota go after all others
+	if lowA, lowB := isQuotaLow(a), isQuotaLow(b); lowA != lowB {
+		return lowB
+	}
+	incumbent := gw.GetBestEndpoint()
+	costA, costB := gw.rankingCost(a), gw.rankingCost(b)
+	if a == incumbent {
+		costA *= 1 - discount
+	} else if b == incumbent {
+		costB *= 1 - discount
+	}
+	if costA != costB {
+		return costA < costB
+	}
+	if gw.config.TieBreaker == config.TieBreakerURL {
+		return a.URL.String() < b.URL.String()
+	}
+	return false
+}
+
+// rankingCost is the value candidates are ranked by, lower first: the
+// weighted latency scaled by the endpoint's cost and uptime factors.
+func (gw *Gateway) rankingCost(ep *types.RpcEndpoint) float64 {
+	return weightedLatency(ep) * gw.costFactor(ep) * gw.uptimeFactor(ep)
+}
+
+// uptimeFactor scales the ranking cost of endpoints with a poorer uptime
+// record: 1 + uptime.weight * (1 - uptime ratio). The caller must hold the
+// read lock.
+func (gw *Gateway) uptimeFactor(ep *types.RpcEndpoint) float64 {
+	return 1 + gw.config.Uptime.Weight*(1-ep.UptimeRatio)
+}
+
+// weightedLatency scales the endpoint's smoothed latency by its effective
+// weight, so a heavier endpoint may be slower and still win, and one whose
+// weight decayed with errors looks slower. A zero weight sorts last.
+func weightedLatency(ep *types.RpcEndpoint) float64 {
+	if ep.EffectiveWeight <= 0 {
+		return math.Inf(1)
+	}
+	return float64(ep.LatencyEWMA) / ep.EffectiveWeight
+}
+
+// smoothLatency folds a latency sample into the exponentially weighted moving
+// average: alpha*sample + (1-alpha)*average. The first sample starts the
+// average, and an alpha of 1 keeps only the last sample.
+func smoothLatency(average, sample time.Duration, alpha float64) time.Duration {
+	if average == 0 {
+		return sample
+	}
+	return time.Duration(alpha*float64(sample) + (1-alpha)*float64(average))
+}
+
+// regionRank returns the position of the endpoint's region in
+// preferredRegions. Endpoints outside the list rank after all listed regions.
+func (gw *Gateway) regionRank(ep *types.RpcEndpoint) int {
+	for i, region := range gw.config.PreferredRegions {
+		if ep.Config.Region == region {
+			return i
+		}
+	}
+	return len(gw.config.PreferredRegions)
+}
+
+// setServingRegion marks the region of the current best endpoint in the
+// serving-region gauge.
+func (gw *Gateway) setServingRegion(region string) {
+	if region == "" {
+		region = "none"
+	}
+	metrics.RpcServingRegion.DeletePartialMatch(prometheus.Labels{"chain": gw.chain})
+	metrics.RpcServingRegion.WithLabelValues(region, gw.chain).Set(1)
+}
+
+// nextBestEndpoint returns the best healthy endpoint other than exclude, or nil
+// if there is none.
+func (gw *Gateway) nextBestEndpoint(exclude *types.RpcEndpoint) *types.RpcEndpoint {
+	return gw.nextBestEndpointWhere(exclude, nil)
+}
+
+// nextBestEndpointWhere is nextBestEndpoint restricted to the endpoints accept
+// returns true for. accept is called with the endpoint's read lock held.
+func (gw *Gateway) nextBestEndpointWhere(exclude *types.RpcEndpoint, accept func(*types.RpcEndpoint) bool) *types.RpcEndpoint {
+	var next *types.RpcEndpoint
+	set := gw.endpointSet.Load()
+	for _, ep := range set.all {
+		if ep == exclude || ep == set.canary {
+			continue
+		}
+		ep.Mutex.RLock()
+		healthy := ep.IsReachable && !ep.IsRateLimited && !ep.HasCredentialError && !gw.excludedBySync(ep) &&
+			(accept == nil || accept(ep))
+		ep.Mutex.RUnlock()
+		if !healthy {
+			continue
+		}
+		if next == nil || gw.lessLocked(ep, next) {
+			next = ep
+		}
+	}
+	return next
+}
+
+// lessUnbiased is candidateLess without the incumbency discount, taking both
+// read locks itself.
+func (gw *Gateway) lessUnbiased(a, b *types.RpcEndpoint) bool {
+	a.Mutex.RLock()
+	defer a.Mutex.RUnlock()
+	b.Mutex.RLock()
+	defer b.Mutex.RUnlock()
+	return gw.lessWithDiscount(a, b, 0)
+}
+
+// lessLocked is candidateLess taking both read locks itself.
+func (gw *Gateway) lessLocked(a, b *types.RpcEndpoint) bool {
+	a.Mutex.RLock()
+	defer a.Mutex.RUnlock()
+	b.Mutex.RLock()
+	defer b.Mutex.RUnlock()
+	return gw.candidateLess(a, b)
+}
+
+// dwellHold returns the current best when minDwell keeps it in place of best:
+// it was promoted less than minDwell ago and is still among the healthy
+// candidates. It returns nil when best may take over.
+func (gw *Gateway) dwellHold(best *types.RpcEndpoint, candidates []*types.RpcEndpoint) *types.RpcEndpoint {
+	current := gw.GetBestEndpoint()
+	if gw.config.MinDwell <= 0 || current == nil || current == best {
+		return nil
+	}
+	promotedAt := gw.promotedAt.Load()
+	if promotedAt == 0 || time.Since(time.Unix(0, promotedAt)) >= gw.config.MinDwell {
+		return nil
+	}
+	if !slices.Contains(candidates, current) {
+		return nil // Unhealthy or out of block tolerance
+	}
+	return current
+}
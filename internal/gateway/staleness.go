@@ -0,0 +1,49 @@
+package gateway
+
+import (
+	"log"
+	"rpc-load-balancer/internal/metrics"
+	"rpc-load-balancer/internal/types"
+	"time"
+)
+
+// updateBlockStaleness flags endpoints whose block height has not advanced
+// for maxBlockStaleness while another reachable endpoint reports a higher
+// block. When every endpoint is stuck, as when the chain itself halted, none
+// is flagged.
+func (gw *Gateway) updateBlockStaleness(endpoints []*types.RpcEndpoint) {
+	var highestBlock int64 = -1
+	for _, ep := range endpoints {
+		ep.Mutex.RLock()
+		if ep.IsReachable && gw.tracksBlocks(ep) && ep.BlockNumber > highestBlock {
+			highestBlock = ep.BlockNumber
+		}
+		ep.Mutex.RUnlock()
+	}
+
+	now := time.Now()
+	for _, ep := range endpoints {
+		ep.Mutex.Lock()
+		stale := gw.tracksBlocks(ep) && !ep.BlockAdvancedAt.IsZero() &&
+			now.Sub(ep.BlockAdvancedAt) > gw.config.MaxBlockStaleness && ep.BlockNumber < highestBlock
+		if stale && !ep.BlockStale {
+			log.Printf("🧊 %s has been stuck at block %d for %v while others reached block %d. Excluding it.",
+				ep.URL.String(), ep.BlockNumber, now.Sub(ep.BlockAdvancedAt).Round(time.Second), highestBlock)
+			ep.BlockStale = true
+			metrics.RpcEndpointBlockStale.WithLabelValues(ep.URL.String()).Set(1)
+		} else if !stale {
+			gw.clearBlockStale(ep)
+		}
+		ep.Mutex.Unlock()
+	}
+}
+
+// clearBlockStale lifts the stale flag of an endpoint whose height advanced
+// or whose peers stopped moving too. The caller must hold the lock.
+func (gw *Gateway) clearBlockStale(ep *types.RpcEndpoint) {
+	if ep.BlockStale {
+		log.Printf("🌊 %s is advancing again at block %d.", ep.URL.String(), ep.BlockNumber)
+		ep.BlockStale = false
+	}
+	metrics.RpcEndpointBlockStale.WithLabelValues(ep.URL.String()).Set(0)
+}
@@ -0,0 +1,89 @@
+package gateway
+
+import (
+	"hash/fnv"
+	"rpc-load-balancer/internal/logging"
+	"rpc-load-balancer/internal/types"
+	"slices"
+	"sync"
+	"time"
+)
+
+// stickySessions maps client IPs to the endpoint serving them. A session
+// expires when ttl passes without a request from the client.
+type stickySessions struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	sessions  map[string]*stickySession
+	lastSweep time.Time
+}
+
+type stickySession struct {
+	ep      *types.RpcEndpoint
+	expires time.Time
+}
+
+// newStickySessions creates the session map, or returns nil when sticky
+// sessions are disabled.
+func newStickySessions(enabled bool, ttl time.Duration) *stickySessions {
+	if !enabled {
+		return nil
+	}
+	return &stickySessions{ttl: ttl, sessions: make(map[string]*stickySession)}
+}
+
+// stickyEndpoint returns the endpoint a client is pinned to. A client
+// without a session, or whose endpoint is no longer healthy or configured,
+// is pinned to a healthy member of the pool chosen by a hash of its IP, or
+// to the current best in first mode.
+func (gw *Gateway) stickyEndpoint(clientIP string) *types.RpcEndpoint {
+	s := gw.sticky
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.lastSweep) > s.ttl {
+		for ip, session := range s.sessions {
+			if now.After(session.expires) {
+				delete(s.sessions, ip)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	session := s.sessions[clientIP]
+	if session != nil && now.Before(session.expires) && gw.servable(session.ep) &&
+		slices.Contains(gw.endpoints(), session.ep) {
+		session.expires = now.Add(s.ttl)
+		return session.ep
+	}
+
+	ep := gw.hashedEndpoint(clientIP)
+	if ep == nil {
+		return nil
+	}
+	if session != nil && session.ep != ep {
+		logging.Limitedf("📌 Moving sticky session of %s from %s to %s", clientIP, session.ep.URL.String(), ep.URL.String())
+	}
+	s.sessions[clientIP] = &stickySession{ep: ep, expires: now.Add(s.ttl)}
+	return ep
+}
+
+// hashedEndpoint maps a client IP to a healthy member of the weighted pool,
+// starting at the member picked by the IP's hash. Without a pool, or without
+// a healthy member, it returns the current best.
+func (gw *Gateway) hashedEndpoint(clientIP string) *types.RpcEndpoint {
+	pool := gw.pool.Load()
+	if pool == nil || len(pool.endpoints) < 2 {
+		return gw.GetBestEndpoint()
+	}
+	h := fnv.New32a()
+	h.Write([]byte(clientIP))
+	start := int(h.Sum32() % uint32(len(pool.endpoints)))
+	for i := range pool.endpoints {
+		ep := pool.endpoints[(start+i)%len(pool.endpoints)]
+		if gw.servable(ep) {
+			return ep
+		}
+	}
+	return gw.GetBestEndpoint()
+}
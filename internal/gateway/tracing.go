@@ -0,0 +1,46 @@
+package gateway
+
+import (
+	"net/http"
+	"rpc-load-balancer/internal/types"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// endRequestSpan records the outcome of a proxied request on its span and
+// ends it.
+func endRequestSpan(span trace.Span, state *requestState, upstream string, status int) {
+	if span.IsRecording() {
+		span.SetAttributes(
+			attribute.String("rpc.request_id", state.requestID),
+			attribute.String("rpc.method", state.method),
+			attribute.String("rpc.upstream", upstream),
+			attribute.Int("http.response.status_code", status),
+		)
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	}
+	span.End()
+}
+
+// endCheckSpan records the outcome of a health check on its span and ends
+// it. The caller must not hold the endpoint lock.
+func endCheckSpan(span trace.Span, ep *types.RpcEndpoint) {
+	if span.IsRecording() {
+		ep.Mutex.RLock()
+		span.SetAttributes(
+			attribute.String("rpc.upstream", ep.URL.String()),
+			attribute.Bool("rpc.reachable", ep.IsReachable),
+			attribute.Int64("rpc.block_number", ep.BlockNumber),
+			attribute.Int64("rpc.latency_ms", ep.Latency.Milliseconds()),
+		)
+		if !ep.IsReachable {
+			span.SetStatus(codes.Error, "endpoint unreachable")
+		}
+		ep.Mutex.RUnlock()
+	}
+	span.End()
+}
@@ -0,0 +1,223 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"rpc-load-balancer/internal/logging"
+	"rpc-load-balancer/internal/metrics"
+	"strings"
+	"sync"
+)
+
+// ResponseTransform rewrites the decoded result of a JSON-RPC call before it
+// is returned to the client. Objects decode to map[string]any, arrays to
+// []any and numbers to json.Number. It returns the replacement result.
+type ResponseTransform func(method string, result any) (any, error)
+
+var (
+	transformsMu       sync.RWMutex
+	responseTransforms = map[string]ResponseTransform{
+		"trimHexZeros":     trimHexZeros,
+		"lowercaseHex":     lowercaseHex,
+		"nullAsEmptyArray": nullAsEmptyArray,
+	}
+)
+
+// RegisterResponseTransform makes a custom transform available to the
+// responseTransforms setting under name. It must be called before NewGateway.
+func RegisterResponseTransform(name string, transform ResponseTransform) {
+	transformsMu.Lock()
+	defer transformsMu.Unlock()
+	responseTransforms[name] = transform
+}
+
+// newResponseTransforms resolves the configured transform names per method.
+func newResponseTransforms(cfg map[string][]string) (map[string][]ResponseTransform, error) {
+	if len(cfg) == 0 {
+		return nil, nil
+	}
+	transformsMu.RLock()
+	defer transformsMu.RUnlock()
+
+	resolved := make(map[string][]ResponseTransform, len(cfg))
+	for method, names := range cfg {
+		for _, name := range names {
+			transform, ok := responseTransforms[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown response transform '%s' for %s", name, method)
+			}
+			resolved[method] = append(resolved[method], transform)
+		}
+	}
+	return resolved, nil
+}
+
+// transformResponse applies the configured transforms to the results of a
+// successful single or batch response. Replies are matched to their calls by
+// id. Compressed bodies are passed through untouched.
+func (gw *Gateway) transformResponse(resp *http.Response, payload *rpcPayload) error {
+	if len(gw.responseTransforms) == 0 || resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil
+	}
+	if enc := resp.Header.Get("Content-Encoding"); enc != "" && enc != "identity" {
+		return nil
+	}
+	methods := make(map[string]string, len(payload.Calls))
+	for _, call := range payload.Calls {
+		if len(gw.responseTransforms[call.Method]) > 0 && !isNotification(call) {
+			methods[idKey(call.ID)] = call.Method
+		}
+	}
+	if len(methods) == 0 {
+		return nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	var entries []json.RawMessage
+	batch := payload.IsBatch
+	if !batch || json.Unmarshal(body, &entries) != nil {
+		// A batch may still be answered with a single error object
+		entries = []json.RawMessage{body}
+		batch = false
+	}
+
+	changed := false
+	for i, entry := range entries {
+		transformed, ok := gw.transformReply(entry, methods)
+		if ok {
+			entries[i] = transformed
+			changed = true
+		}
+	}
+	if !changed {
+		replaceBody(resp, body)
+		return nil
+	}
+
+	if batch {
+		body, err = json.Marshal(entries)
+		if err != nil {
+			return err
+		}
+	} else {
+		body = entries[0]
+	}
+	replaceBody(resp, body)
+	return nil
+}
+
+// transformReply runs the transforms for the call answered by one reply. It
+// returns false when the reply is left as it is, including when a transform
+// fails.
+func (gw *Gateway) transformReply(entry json.RawMessage, methods map[string]string) (json.RawMessage, bool) {
+	var reply map[string]json.RawMessage
+	if err := json.Unmarshal(entry, &reply); err != nil {
+		return nil, false
+	}
+	raw, hasResult := reply["result"]
+	method, ok := methods[idKey(reply["id"])]
+	if !ok || !hasResult {
+		return nil, false
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var result any
+	if err := dec.Decode(&result); err != nil {
+		return nil, false
+	}
+	var err error
+	for _, transform := range gw.responseTransforms[method] {
+		if result, err = transform(method, result); err != nil {
+			logging.Limitedf("❌ Response transform for %s failed: %v", method, err)
+			metrics.RpcResponseTransformsTotal.WithLabelValues(metrics.MethodLabel(method), "error", gw.chain).Inc()
+			return nil, false
+		}
+	}
+
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		return nil, false
+	}
+	reply["result"] = encoded
+	transformed, err := json.Marshal(reply)
+	if err != nil {
+		return nil, false
+	}
+	metrics.RpcResponseTransformsTotal.WithLabelValues(metrics.MethodLabel(method), "applied", gw.chain).Inc()
+	return transformed, true
+}
+
+// trimHexZeros strips leading zeros from hex quantities, e.g. "0x01" becomes
+// "0x1" as required by the Ethereum JSON-RPC spec. Only strings of at most 66
+// characters are touched, which leaves long data blobs alone; 32-byte hashes
+// fit that limit too, so enable it only for methods returning quantities.
+func trimHexZeros(_ string, result any) (any, error) {
+	return walkStrings(result, func(s string) string {
+		if len(s) < 4 || len(s) > 66 || !isHexString(s) || s[2] != '0' {
+			return s
+		}
+		digits := strings.TrimLeft(s[2:], "0")
+		if digits == "" {
+			digits = "0"
+		}
+		return "0x" + digits
+	}), nil
+}
+
+// lowercaseHex lowercases hex strings such as checksummed addresses.
+func lowercaseHex(_ string, result any) (any, error) {
+	return walkStrings(result, func(s string) string {
+		if !isHexString(s) {
+			return s
+		}
+		return strings.ToLower(s)
+	}), nil
+}
+
+// nullAsEmptyArray replaces a null result with [], for providers answering
+// e.g. eth_getLogs with null when nothing matches.
+func nullAsEmptyArray(_ string, result any) (any, error) {
+	if result == nil {
+		return []any{}, nil
+	}
+	return result, nil
+}
+
+// walkStrings applies fn to every string in a decoded JSON value.
+func walkStrings(value any, fn func(string) string) any {
+	switch v := value.(type) {
+	case string:
+		return fn(v)
+	case []any:
+		for i := range v {
+			v[i] = walkStrings(v[i], fn)
+		}
+	case map[string]any:
+		for key := range v {
+			v[key] = walkStrings(v[key], fn)
+		}
+	}
+	return value
+}
+
+// isHexString reports whether s is a 0x-prefixed string of hex digits.
+func isHexString(s string) bool {
+	if len(s) < 3 || s[0] != '0' || (s[1] != 'x' && s[1] != 'X') {
+		return false
+	}
+	for _, c := range s[2:] {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,127 @@
+package gateway
+
+import (
+	"crypto/tls"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"rpc-load-balancer/internal/config"
+	"rpc-load-balancer/internal/types"
+	"time"
+)
+
+// newEndpointTransport returns a dedicated transport for an endpoint with
+// custom TLS settings or its own connect timeout, or nil when it can share
+// the gateway's transport.
+func newEndpointTransport(base *http.Transport, epCfg config.EndpointConfig, connectTimeout time.Duration) *http.Transport {
+	if !epCfg.TLS.IsSet() && epCfg.ConnectTimeout == connectTimeout {
+		return nil
+	}
+
+	transport := base.Clone()
+	if epCfg.ConnectTimeout != connectTimeout {
+		setConnectTimeout(transport, epCfg.ConnectTimeout)
+	}
+	if epCfg.TLS.IsSet() {
+		warnWeakTLS(epCfg.URL, epCfg.TLS)
+		transport.TLSClientConfig = &tls.Config{
+			MinVersion:         epCfg.TLS.MinVersion,
+			MaxVersion:         epCfg.TLS.MaxVersion,
+			CipherSuites:       epCfg.TLS.CipherSuites,
+			InsecureSkipVerify: epCfg.TLS.InsecureSkipVerify,
+		}
+	}
+	return transport
+}
+
+// setConnectTimeout limits how long the transport waits to establish a TCP
+// connection. 0 keeps Go's default of 30s.
+func setConnectTimeout(transport *http.Transport, timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	dialer := &net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}
+	transport.DialContext = dialer.DialContext
+}
+
+// setConnectionPooling applies the idle connection settings. Go keeps only
+// two idle connections per host by default, so under bursts most requests
+// would open, and TLS-handshake, a connection of their own. The total of idle
+// connections is bounded by the per-host limit alone.
+func setConnectionPooling(transport *http.Transport, cfg *config.Config) {
+	transport.MaxIdleConns = 0
+	transport.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+	transport.IdleConnTimeout = cfg.IdleConnTimeout
+	transport.DisableKeepAlives = cfg.DisableKeepAlives
+}
+
+// warnWeakTLS logs a startup warning for TLS settings weaker than Go's defaults.
+func warnWeakTLS(endpointURL string, t config.TLSConfig) {
+	if t.MinVersion != 0 && t.MinVersion < tls.VersionTLS12 {
+		log.Printf("⚠️ Endpoint %s allows TLS versions below 1.2 (minVersion %s)", endpointURL, t.MinVersionStr)
+	}
+	for _, suite := range tls.InsecureCipherSuites() {
+		for _, id := range t.CipherSuites {
+			if suite.ID == id {
+				log.Printf("⚠️ Endpoint %s enables insecure cipher suite %s", endpointURL, suite.Name)
+			}
+		}
+	}
+	if t.InsecureSkipVerify {
+		log.Printf("⚠️ Endpoint %s skips TLS certificate verification", endpointURL)
+	}
+}
+
+// transportFor returns the transport used to reach an endpoint.
+func (gw *Gateway) transportFor(ep *types.RpcEndpoint) http.RoundTripper {
+	if ep.Transport != nil {
+		return ep.Transport
+	}
+	return gw.transport
+}
+
+// clientFor returns an HTTP client for health checks against an endpoint,
+// limited to the endpoint's healthCheckTimeout.
+func (gw *Gateway) clientFor(ep *types.RpcEndpoint) *http.Client {
+	return &http.Client{
+		Timeout:   ep.Config.HealthCheckTimeout,
+		Transport: gw.transportFor(ep),
+	}
+}
+
+// timeoutReason classifies a failed health-check request: "connect_timeout"
+// when the TCP connection could not be established in time,
+// "response_timeout" when the overall healthCheckTimeout expired, else
+// "http_do".
+func timeoutReason(err error) string {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" && opErr.Timeout() {
+		return "connect_timeout"
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return "response_timeout"
+	}
+	return "http_do"
+}
+
+// proxyTransport sends proxied requests through the transport of the
+// endpoint chosen for the request.
+type proxyTransport struct {
+	gw *Gateway
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *proxyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	state := stateFromContext(req.Context())
+	if state == nil {
+		return t.gw.transport.RoundTrip(req)
+	}
+	if t.gw.canHedge(req, state) {
+		if next := t.gw.nextBestEndpoint(state.endpoint); next != nil {
+			return t.gw.roundTripHedged(req, state, next)
+		}
+	}
+	return t.gw.roundTripWithFailover(req, state)
+}
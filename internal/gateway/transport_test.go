@@ -0,0 +1,104 @@
+package gateway
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTimeoutReason(t *testing.T) {
+	// Accepts connections but never answers, not even a TLS handshake
+	silent, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+	go func() {
+		for {
+			conn, err := silent.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	release := make(chan struct{})
+	slowHeaders := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slowHeaders.Close()
+	slowBody := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		<-release
+	}))
+	defer slowBody.Close()
+	defer close(release) // Runs first, as closing a server waits for its handlers
+
+	// Refuses connections
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedURL := "http://" + closed.Addr().String()
+	closed.Close()
+
+	const timeout = 100 * time.Millisecond
+	tests := []struct {
+		name      string
+		url       string
+		transport func(*http.Transport)
+		readBody  bool
+		want      string
+	}{
+		{
+			name: "dial timeout",
+			url:  slowHeaders.URL,
+			transport: func(tr *http.Transport) {
+				setConnectTimeout(tr, time.Nanosecond)
+			},
+			want: "connect_timeout",
+		},
+		{
+			name: "TLS handshake timeout",
+			url:  "https://" + silent.Addr().String(),
+			transport: func(tr *http.Transport) {
+				tr.TLSHandshakeTimeout = timeout / 2
+			},
+			want: "response_timeout",
+		},
+		{name: "header timeout", url: slowHeaders.URL, want: "response_timeout"},
+		{name: "body timeout", url: slowBody.URL, readBody: true, want: "response_timeout"},
+		{name: "connection refused", url: closedURL, want: "http_do"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := http.DefaultTransport.(*http.Transport).Clone()
+			if tt.transport != nil {
+				tt.transport(transport)
+			}
+			defer transport.CloseIdleConnections()
+			client := &http.Client{Timeout: timeout, Transport: transport}
+
+			resp, err := client.Get(tt.url)
+			if err == nil {
+				if !tt.readBody {
+					resp.Body.Close()
+					t.Fatal("request succeeded, want an error")
+				}
+				_, err = io.ReadAll(resp.Body)
+				resp.Body.Close()
+				if err == nil {
+					t.Fatal("reading the body succeeded, want an error")
+				}
+			}
+			if got := timeoutReason(err); got != tt.want {
+				t.Errorf("timeoutReason(%v) = %q, want %q", err, got, tt.want)
+			}
+		})
+	}
+}
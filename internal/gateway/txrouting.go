@@ -0,0 +1,101 @@
+package gateway
+
+import (
+	"encoding/json"
+	"log"
+	"rpc-load-balancer/internal/config"
+	"rpc-load-balancer/internal/logging"
+	"rpc-load-balancer/internal/metrics"
+	"rpc-load-balancer/internal/types"
+)
+
+const (
+	peerCountMethod    = "net_peerCount"
+	txPoolStatusMethod = "txpool_status"
+)
+
+// probeTxHealth runs the txRouting checks: net_peerCount, then txpool_status
+// when configured.
+func (gw *Gateway) probeTxHealth(ep *types.RpcEndpoint) []probeResult {
+	results := []probeResult{gw.probe(ep, config.HealthCheckMethod{Method: peerCountMethod})}
+	if gw.config.TxRouting.TxPoolCheck {
+		results = append(results, gw.probe(ep, config.HealthCheckMethod{Method: txPoolStatusMethod}))
+	}
+	return results
+}
+
+// updateTxStatus records the txRouting check results and decides whether the
+// endpoint should receive transactions. The caller must hold the lock.
+func (gw *Gateway) updateTxStatus(ep *types.RpcEndpoint, results []probeResult) {
+	endpointURL := ep.URL.String()
+	cfg := gw.config.TxRouting
+	ready := true
+	for _, res := range results {
+		if res.reason != "" {
+			logging.Limitedf("%s", res.message)
+			metrics.RpcCheckErrorsTotal.WithLabelValues(endpointURL, "tx_"+res.reason).Inc()
+			ready = false
+			continue
+		}
+
+		switch res.method {
+		case peerCountMethod:
+			peers, err := parseQuantity(res.result)
+			if err != nil {
+				ready = false
+				continue
+			}
+			ep.PeerCount = peers
+			metrics.RpcEndpointPeerCount.WithLabelValues(endpointURL).Set(float64(peers))
+			ready = ready && peers >= cfg.MinPeers
+		case txPoolStatusMethod:
+			var status struct {
+				Queued json.RawMessage `json:"queued"`
+			}
+			if json.Unmarshal(res.result, &status) != nil {
+				ready = false
+				continue
+			}
+			if cfg.MaxQueued > 0 {
+				queued, err := parseQuantity(status.Queued)
+				ready = ready && err == nil && queued <= cfg.MaxQueued
+			}
+		}
+	}
+
+	if ready != ep.TxReady {
+		if ready {
+			log.Printf("📡 %s passes the txRouting checks", endpointURL)
+		} else {
+			log.Printf("📡 %s failed the txRouting checks (peers: %d), avoiding it for transactions", endpointURL, ep.PeerCount)
+		}
+	}
+	ep.TxReady = ready
+	if ready {
+		metrics.RpcEndpointTxReady.WithLabelValues(endpointURL).Set(1)
+	} else {
+		metrics.RpcEndpointTxReady.WithLabelValues(endpointURL).Set(0)
+	}
+}
+
+// txEndpoint returns the endpoint a transaction submission should go to: best
+// if it passes the txRouting checks, else the best endpoint that does. When no
+// endpoint passes, best is used anyway.
+func (gw *Gateway) txEndpoint(best *types.RpcEndpoint) *types.RpcEndpoint {
+	if !gw.config.TxRouting.Enabled {
+		return best
+	}
+	best.Mutex.RLock()
+	ready := best.TxReady
+	best.Mutex.RUnlock()
+	if ready {
+		return best
+	}
+
+	next := gw.nextBestEndpointWhere(best, func(ep *types.RpcEndpoint) bool { return ep.TxReady })
+	if next == nil {
+		return best
+	}
+	metrics.RpcTxReroutedTotal.WithLabelValues(next.URL.String()).Inc()
+	return next
+}
@@ -0,0 +1,51 @@
+package gateway
+
+import (
+	"context"
+	"rpc-load-balancer/internal/types"
+	"sync"
+	"time"
+)
+
+// EndpointReport is the state of an endpoint after a health check, as shown
+// by the validate command.
+type EndpointReport struct {
+	URL         string // Credentials masked
+	Status      string // "ok", or why the endpoint cannot be selected
+	BlockNumber int64
+	Latency     time.Duration
+}
+
+// CheckEndpoints runs one health check against every endpoint concurrently,
+// without selecting a best endpoint, and reports the outcome in config order.
+func (gw *Gateway) CheckEndpoints(ctx context.Context) []EndpointReport {
+	endpoints := gw.endpoints()
+	var wg sync.WaitGroup
+	for _, ep := range endpoints {
+		wg.Add(1)
+		go func(ep *types.RpcEndpoint) {
+			defer wg.Done()
+			gw.CheckEndpointStatus(ctx, ep)
+		}(ep)
+	}
+	wg.Wait()
+
+	reports := make([]EndpointReport, 0, len(endpoints))
+	for _, ep := range endpoints {
+		ep.Mutex.RLock()
+		report := EndpointReport{URL: ep.URL.Redacted(), Status: "ok", BlockNumber: ep.BlockNumber, Latency: ep.Latency}
+		switch {
+		case ep.HasCredentialError:
+			report.Status = "credentials rejected"
+		case ep.IsRateLimited:
+			report.Status = "rate limited"
+		case !ep.IsReachable:
+			report.Status = "unreachable"
+		case gw.excludedBySync(ep):
+			report.Status = "syncing"
+		}
+		ep.Mutex.RUnlock()
+		reports = append(reports, report)
+	}
+	return reports
+}
@@ -0,0 +1,77 @@
+package gateway
+
+import (
+	"net/http"
+	"rpc-load-balancer/internal/config"
+	"rpc-load-balancer/internal/types"
+)
+
+// variantDefault labels requests without a known variant header value.
+const variantDefault = "default"
+
+// newVariantPools resolves the endpoint URLs of every variant pool.
+func newVariantPools(cfg config.VariantsConfig, endpoints []*types.RpcEndpoint) map[string]map[*types.RpcEndpoint]bool {
+	if len(cfg.Pools) == 0 {
+		return nil
+	}
+	pools := make(map[string]map[*types.RpcEndpoint]bool, len(cfg.Pools))
+	for variant, urls := range cfg.Pools {
+		pool := make(map[*types.RpcEndpoint]bool, len(urls))
+		for _, url := range urls {
+			for _, ep := range endpoints {
+				if ep.Config.URL == url {
+					pool[ep] = true
+				}
+			}
+		}
+		pools[variant] = pool
+	}
+	return pools
+}
+
+// requestVariant returns the variant named by the request's variant header,
+// or variantDefault when it names no configured pool.
+func (gw *Gateway) requestVariant(r *http.Request) string {
+	pools := gw.endpointSet.Load().variantPools
+	if len(pools) == 0 {
+		return variantDefault
+	}
+	variant := r.Header.Get(gw.config.Variants.Header)
+	if _, ok := pools[variant]; !ok {
+		return variantDefault
+	}
+	return variant
+}
+
+// inVariantPool reports whether the endpoint belongs to any variant pool.
+func (gw *Gateway) inVariantPool(ep *types.RpcEndpoint) bool {
+	for _, pool := range gw.endpointSet.Load().variantPools {
+		if pool[ep] {
+			return true
+		}
+	}
+	return false
+}
+
+// variantEndpoint returns the endpoint serving the request's variant: best if
+// it is in the variant's pool, else the best healthy endpoint that is. The
+// default variant may use every endpoint, or with variants.exclusive only
+// those outside all pools. It returns nil when the pool has no healthy
+// endpoint.
+func (gw *Gateway) variantEndpoint(best *types.RpcEndpoint, variant string) *types.RpcEndpoint {
+	var accept func(*types.RpcEndpoint) bool
+	switch {
+	case variant != variantDefault:
+		pool := gw.endpointSet.Load().variantPools[variant]
+		accept = func(ep *types.RpcEndpoint) bool { return pool[ep] }
+	case gw.config.Variants.Exclusive:
+		accept = func(ep *types.RpcEndpoint) bool { return !gw.inVariantPool(ep) }
+	default:
+		return best
+	}
+
+	if accept(best) {
+		return best
+	}
+	return gw.nextBestEndpointWhere(best, accept)
+}
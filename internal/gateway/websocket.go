@@ -0,0 +1,108 @@
+package gateway
+
+import (
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"rpc-load-balancer/internal/logging"
+	"rpc-load-balancer/internal/metrics"
+	"rpc-load-balancer/internal/types"
+	"strings"
+)
+
+// isWebSocketUpgrade reports whether the request asks to switch to the
+// WebSocket protocol.
+func isWebSocketUpgrade(r *http.Request) bool {
+	return headerHasToken(r.Header, "Connection", "upgrade") && strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
+// headerHasToken reports whether a comma-separated header contains token,
+// ignoring case.
+func headerHasToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, t := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// newWebSocketProxy creates the proxy for WebSocket upgrade requests. The
+// reverse proxy hijacks the client connection once the upstream answers 101
+// Switching Protocols and copies frames both ways until either side closes.
+// Requests go straight to the endpoint's transport: there is no body to
+// buffer, retry or hedge.
+func (gw *Gateway) newWebSocketProxy() http.Handler {
+	return &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			state := stateFromContext(req.Context())
+			ep := state.endpoint
+			gw.setForwardedHost(req)
+			req.URL.Scheme = "http"
+			if ep.WsURL.Scheme == "wss" {
+				req.URL.Scheme = "https"
+			}
+			req.URL.Host = ep.WsURL.Host
+			req.URL.Path = upstreamPath(ep.WsURL.Path, state.path, ep.Config.PathMode)
+			req.URL.RawPath = ""
+			if !gw.config.PreserveHostHeader {
+				req.Host = ep.WsURL.Host
+			}
+			setEndpointHeaders(req.Header, ep)
+			req.Header.Set(requestIDHeader, state.requestID)
+			log.Printf("  -> [%s] Forwarding WebSocket %s to %s", state.requestID, req.URL.Path, ep.WsURL.Redacted())
+		},
+		Transport: &webSocketTransport{gw: gw},
+		ModifyResponse: func(resp *http.Response) error {
+			if resp.StatusCode == http.StatusSwitchingProtocols {
+				stateFromContext(resp.Request.Context()).upgraded = true
+			}
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			logging.Limitedf("❌ WebSocket proxy error: %v", err)
+			state := stateFromContext(r.Context())
+			state.endpoint.Mutex.Lock()
+			gw.recordProxyOutcome(state.endpoint, true)
+			state.endpoint.Mutex.Unlock()
+			gw.writeError(w, r, http.StatusBadGateway, rpcCodeServerError, "Bad Gateway")
+		},
+	}
+}
+
+// webSocketTransport sends a handshake through the pinned endpoint's transport.
+type webSocketTransport struct {
+	gw *Gateway
+}
+
+func (t *webSocketTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.gw.transportFor(stateFromContext(req.Context()).endpoint).RoundTrip(req)
+}
+
+// serveWebSocket proxies a WebSocket upgrade request to the best healthy
+// endpoint with a wsUrl. It returns once the connection is closed.
+func (gw *Gateway) serveWebSocket(w http.ResponseWriter, r *http.Request, state *requestState) {
+	ep := gw.webSocketEndpoint(state.endpoint)
+	if ep == nil {
+		gw.writeError(w, r, http.StatusServiceUnavailable, rpcCodeServerError, "no healthy endpoint accepts WebSocket connections")
+		return
+	}
+	state.endpoint = ep
+
+	connections := metrics.RpcWebSocketConnections.WithLabelValues(ep.URL.String())
+	connections.Inc()
+	defer connections.Dec()
+	gw.webSocketProxy.ServeHTTP(w, r)
+}
+
+// webSocketEndpoint returns best if it has a wsUrl, else the best healthy
+// endpoint that does, or nil if there is none. Health is judged by the
+// regular HTTP checks against each endpoint's url.
+func (gw *Gateway) webSocketEndpoint(best *types.RpcEndpoint) *types.RpcEndpoint {
+	if best != nil && best.WsURL != nil {
+		return best
+	}
+	return gw.nextBestEndpointWhere(best, func(ep *types.RpcEndpoint) bool { return ep.WsURL != nil })
+}
@@ -0,0 +1,96 @@
+package listener
+
+import (
+	"net"
+	"rpc-load-balancer/internal/config"
+	"rpc-load-balancer/internal/metrics"
+	"sync"
+)
+
+// wrapLimit caps the simultaneous connections of the listener at
+// cfg.MaxConnections, if set.
+func wrapLimit(ln net.Listener, cfg config.ListenerConfig) net.Listener {
+	if cfg.MaxConnections <= 0 {
+		return ln
+	}
+	return &limitListener{
+		Listener: ln,
+		slots:    make(chan struct{}, cfg.MaxConnections),
+		queue:    cfg.OverLimit == config.ConnLimitQueue,
+		done:     make(chan struct{}),
+	}
+}
+
+// limitListener holds one slot per open connection. At the limit it either
+// closes new connections right away or, in queue mode, stops accepting until
+// a slot frees up, leaving new connections in the kernel backlog.
+type limitListener struct {
+	net.Listener
+	slots     chan struct{}
+	queue     bool
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Accept waits for the next connection that fits within the limit.
+func (l *limitListener) Accept() (net.Conn, error) {
+	for {
+		if l.queue {
+			select {
+			case l.slots <- struct{}{}:
+			case <-l.done:
+				return nil, net.ErrClosed
+			}
+		}
+
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			if l.queue {
+				<-l.slots
+			}
+			return nil, err
+		}
+
+		if !l.queue {
+			select {
+			case l.slots <- struct{}{}:
+			default:
+				conn.Close()
+				metrics.GatewayRejectedConnectionsTotal.Inc()
+				continue
+			}
+		}
+		metrics.GatewayConnections.Inc()
+		return &limitedConn{Conn: conn, release: l.release}, nil
+	}
+}
+
+// Close stops accepting and closes the underlying listener.
+func (l *limitListener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return l.Listener.Close()
+}
+
+// Unwrap returns the underlying listener.
+func (l *limitListener) Unwrap() net.Listener {
+	return l.Listener
+}
+
+func (l *limitListener) release() {
+	metrics.GatewayConnections.Dec()
+	<-l.slots
+}
+
+// limitedConn frees its listener slot when closed.
+type limitedConn struct {
+	net.Conn
+	release   func()
+	closeOnce sync.Once
+}
+
+// Close closes the connection and frees its slot once.
+func (c *limitedConn) Close() error {
+	err := c.Conn.Close()
+	c.closeOnce.Do(c.release)
+	return err
+}
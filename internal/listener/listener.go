@@ -0,0 +1,87 @@
+package listener
+
+import (
+	"context"
+	"net"
+	"rpc-load-balancer/internal/config"
+)
+
+// Listen opens a TCP listener on addr and applies the socket options from cfg.
+// Unset options keep Go's defaults (TCP_NODELAY on, 15s keep-alive). An addr
+// of the form "unix:/path/to/sock" opens a Unix domain socket instead, to
+// which only maxConnections applies. If a parent process handed over a
+// listener with the same name during a graceful restart, that socket is
+// reused instead of binding a new one.
+func Listen(ctx context.Context, name, addr string, cfg config.ListenerConfig) (net.Listener, error) {
+	ln, err := inheritedListener(name)
+	if err != nil {
+		return nil, err
+	}
+	if ln != nil {
+		setUnlinkOnClose(ln, true) // The socket file is this process's to clean up now
+		return wrapLimit(wrapNoDelay(ln, cfg), cfg), nil
+	}
+	if path, ok := UnixSocketPath(addr); ok {
+		if ln, err = listenUnix(ctx, path); err != nil {
+			return nil, err
+		}
+		return wrapLimit(ln, cfg), nil
+	}
+
+	lc := net.ListenConfig{}
+
+	if cfg.KeepAlive < 0 {
+		lc.KeepAlive = -1 // Disable keep-alive probes
+	} else if cfg.KeepAlive > 0 || cfg.KeepAliveInterval > 0 || cfg.KeepAliveCount > 0 {
+		lc.KeepAliveConfig = net.KeepAliveConfig{
+			Enable:   true,
+			Idle:     cfg.KeepAlive,
+			Interval: cfg.KeepAliveInterval,
+			Count:    cfg.KeepAliveCount,
+		}
+	}
+
+	if cfg.ReusePort {
+		lc.Control = controlReusePort
+	}
+
+	ln, err = lc.Listen(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return wrapLimit(wrapNoDelay(ln, cfg), cfg), nil
+}
+
+// wrapNoDelay applies a non-default TCP_NODELAY setting to accepted connections.
+func wrapNoDelay(ln net.Listener, cfg config.ListenerConfig) net.Listener {
+	if cfg.TCPNoDelay != nil && !*cfg.TCPNoDelay {
+		return &noDelayListener{Listener: ln, noDelay: false}
+	}
+	return ln
+}
+
+// noDelayListener overrides TCP_NODELAY on every accepted connection.
+type noDelayListener struct {
+	net.Listener
+	noDelay bool
+}
+
+// Unwrap returns the underlying listener.
+func (l *noDelayListener) Unwrap() net.Listener {
+	return l.Listener
+}
+
+// Accept waits for the next connection and applies the TCP_NODELAY setting.
+func (l *noDelayListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		if err := tcpConn.SetNoDelay(l.noDelay); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
@@ -0,0 +1,122 @@
+package listener
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// inheritEnvVar lists the names of the listeners passed to a restarted
+// process. The listeners arrive as extra files starting at fd 3, in the
+// same order as the names.
+const inheritEnvVar = "RPC_GATEWAY_INHERITED_LISTENERS"
+
+// firstInheritedFD is the descriptor of the first extra file given to a child.
+const firstInheritedFD = 3
+
+// inheritedListener returns the listener with the given name handed over by
+// a parent process, or nil if this process was not started by a restart.
+func inheritedListener(name string) (net.Listener, error) {
+	inherited := os.Getenv(inheritEnvVar)
+	if inherited == "" {
+		return nil, nil
+	}
+	for i, n := range strings.Split(inherited, ",") {
+		if n != name {
+			continue
+		}
+		f := os.NewFile(uintptr(firstInheritedFD+i), name)
+		if f == nil {
+			return nil, fmt.Errorf("inherited listener %s has an invalid descriptor", name)
+		}
+		defer f.Close()
+		return net.FileListener(f)
+	}
+	return nil, nil
+}
+
+// Restart starts a new copy of the running binary that inherits the given
+// listeners, so it accepts connections on the same sockets while this
+// process drains. It returns the PID of the new process.
+func Restart(listeners map[string]net.Listener) (int, error) {
+	names := make([]string, 0, len(listeners))
+	for name := range listeners {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	files := make([]*os.File, 0, len(names))
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	for _, name := range names {
+		f, err := listenerFile(listeners[name])
+		if err != nil {
+			return 0, fmt.Errorf("failed to get file for %s listener: %w", name, err)
+		}
+		files = append(files, f)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return 0, fmt.Errorf("failed to locate executable: %w", err)
+	}
+
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = files
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, inheritEnvVar+"=") {
+			cmd.Env = append(cmd.Env, kv)
+		}
+	}
+	cmd.Env = append(cmd.Env, inheritEnvVar+"="+strings.Join(names, ","))
+
+	if err := cmd.Start(); err != nil {
+		return 0, fmt.Errorf("failed to start new process: %w", err)
+	}
+	// The new process serves on the socket files now, so draining this one
+	// must not remove them
+	for _, ln := range listeners {
+		setUnlinkOnClose(ln, false)
+	}
+	return cmd.Process.Pid, nil
+}
+
+// IsRestartSignal reports whether sig requests a graceful restart.
+func IsRestartSignal(sig os.Signal) bool {
+	return RestartSignal != nil && sig == RestartSignal
+}
+
+// listenerFile returns a duplicate of the listener's socket descriptor.
+func listenerFile(ln net.Listener) (*os.File, error) {
+	type filer interface {
+		File() (*os.File, error)
+	}
+	if f, ok := innermost(ln).(filer); ok {
+		return f.File()
+	}
+	return nil, errors.New("listener does not expose its file descriptor")
+}
+
+// innermost returns the listener at the bottom of a chain of wrappers.
+func innermost(ln net.Listener) net.Listener {
+	type unwrapper interface {
+		Unwrap() net.Listener
+	}
+	for {
+		u, ok := ln.(unwrapper)
+		if !ok {
+			return ln
+		}
+		ln = u.Unwrap()
+	}
+}
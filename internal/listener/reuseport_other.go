@@ -0,0 +1,13 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package listener
+
+import (
+	"errors"
+	"syscall"
+)
+
+// controlReusePort fails on platforms without SO_REUSEPORT.
+func controlReusePort(network, address string, c syscall.RawConn) error {
+	return errors.New("reusePort is not supported on this platform")
+}
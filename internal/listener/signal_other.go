@@ -0,0 +1,8 @@
+//go:build !unix
+
+package listener
+
+import "os"
+
+// RestartSignal is nil where graceful restarts are not supported.
+var RestartSignal os.Signal
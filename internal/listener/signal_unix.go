@@ -0,0 +1,11 @@
+//go:build unix
+
+package listener
+
+import (
+	"os"
+	"syscall"
+)
+
+// RestartSignal triggers a graceful restart when gracefulRestart is enabled.
+var RestartSignal os.Signal = syscall.SIGUSR2
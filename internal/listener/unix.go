@@ -0,0 +1,44 @@
+package listener
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// unixPrefix marks a listen address as the path of a Unix domain socket.
+const unixPrefix = "unix:"
+
+// UnixSocketPath returns the socket path of a "unix:/path/to/sock" address,
+// or false for a TCP address.
+func UnixSocketPath(addr string) (string, bool) {
+	return strings.CutPrefix(addr, unixPrefix)
+}
+
+// listenUnix opens a Unix domain socket at path. A socket file left behind
+// by a process that did not shut down cleanly is removed first, unless a
+// process still accepts connections on it. The file is removed again when
+// the listener is closed.
+func listenUnix(ctx context.Context, path string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("socket %s is in use by another process", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket %s: %w", path, err)
+		}
+	}
+	lc := net.ListenConfig{}
+	return lc.Listen(ctx, "unix", path)
+}
+
+// setUnlinkOnClose sets whether closing ln removes its socket file, if ln is
+// a Unix domain socket listener.
+func setUnlinkOnClose(ln net.Listener, unlink bool) {
+	if ul, ok := innermost(ln).(*net.UnixListener); ok {
+		ul.SetUnlinkOnClose(unlink)
+	}
+}
@@ -0,0 +1,54 @@
+// Package logging holds the gateway's leveled logger for verbose diagnostics
+// and structured events. Operational messages keep using the standard log
+// package.
+package logging
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"os"
+)
+
+// Logger receives debug output and, in JSON mode, structured events.
+// Messages below its level are dropped before any formatting happens, so
+// disabled debug calls cost almost nothing.
+var Logger = newLogger(false, false)
+
+// structured is set in JSON mode; see Structured.
+var structured bool
+
+// DebugEnabled reports whether debug messages are written. Check it before
+// building expensive arguments.
+func DebugEnabled() bool {
+	return Logger.Enabled(context.Background(), slog.LevelDebug)
+}
+
+// Structured reports whether events are logged as JSON with fields rather
+// than as formatted text lines.
+func Structured() bool {
+	return structured
+}
+
+// Setup sets the log level and format: debug messages are only written when
+// verbose is on. With jsonFormat the standard log package is routed through
+// the JSON handler too, so every line becomes a JSON object.
+func Setup(verbose, jsonFormat bool) {
+	structured = jsonFormat
+	Logger = newLogger(verbose, jsonFormat)
+	if jsonFormat {
+		slog.SetDefault(Logger)
+	}
+}
+
+func newLogger(verbose, jsonFormat bool) *slog.Logger {
+	level := slog.LevelInfo
+	if verbose {
+		level = slog.LevelDebug
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	if jsonFormat {
+		return slog.New(slog.NewJSONHandler(os.Stderr, opts))
+	}
+	return slog.New(slog.NewTextHandler(log.Writer(), opts))
+}
@@ -0,0 +1,86 @@
+package logging
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// limitedEntry tracks a message logged through Limitedf.
+type limitedEntry struct {
+	logged     time.Time // When the message was last written
+	suppressed int       // Repeats dropped since then
+}
+
+var limiter = struct {
+	sync.Mutex
+	window    time.Duration
+	summarize bool
+	entries   map[string]*limitedEntry
+}{entries: make(map[string]*limitedEntry)}
+
+// SetupRateLimit makes Limitedf write identical messages at most once per
+// window. With summarize on, the number of dropped repeats is logged once the
+// window has passed. A zero window logs every message. Call it once at
+// startup, before any Limitedf call.
+func SetupRateLimit(window time.Duration, summarize bool) {
+	limiter.Lock()
+	limiter.window = window
+	limiter.summarize = summarize
+	limiter.Unlock()
+
+	if window > 0 {
+		go func() {
+			for range time.Tick(window) {
+				sweepLimited(time.Now())
+			}
+		}()
+	}
+}
+
+// Limitedf logs like log.Printf, but drops repeats of the same message within
+// the configured window. Use it on error paths that can fire for every
+// request or check during an outage.
+func Limitedf(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+
+	limiter.Lock()
+	defer limiter.Unlock()
+	if limiter.window <= 0 {
+		log.Print(msg)
+		return
+	}
+
+	now := time.Now()
+	entry, ok := limiter.entries[msg]
+	if ok && now.Sub(entry.logged) < limiter.window {
+		entry.suppressed++
+		return
+	}
+	if ok {
+		reportSuppressed(msg, entry)
+	}
+	limiter.entries[msg] = &limitedEntry{logged: now}
+	log.Print(msg)
+}
+
+// sweepLimited reports and forgets messages whose window has passed.
+func sweepLimited(now time.Time) {
+	limiter.Lock()
+	defer limiter.Unlock()
+	for msg, entry := range limiter.entries {
+		if now.Sub(entry.logged) >= limiter.window {
+			reportSuppressed(msg, entry)
+			delete(limiter.entries, msg)
+		}
+	}
+}
+
+// reportSuppressed logs how often msg was dropped, if summaries are on. The
+// caller must hold the limiter lock.
+func reportSuppressed(msg string, entry *limitedEntry) {
+	if limiter.summarize && entry.suppressed > 0 {
+		log.Printf("%s (repeated %d more times in %v)", msg, entry.suppressed, limiter.window)
+	}
+}
@@ -6,9 +6,11 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-func MetricsHandler() http.Handler {
+// MetricsHandler returns a mux serving the Prometheus metrics at path.
+// Admin routes may be registered on the same mux.
+func MetricsHandler(path string) *http.ServeMux {
 	mux := http.NewServeMux()
-	mux.Handle("/metrics", promhttp.Handler())
+	mux.Handle(path, promhttp.Handler())
 
 	return mux
 }
@@ -0,0 +1,44 @@
+package metrics
+
+// Method label values that are not JSON-RPC method names.
+const (
+	MethodLabelOther = "other" // Method outside the known set
+	MethodLabelBatch = "batch" // Batch request
+	MethodLabelNone  = "none"  // Not a JSON-RPC request
+)
+
+// knownMethods are the standard JSON-RPC methods used as metric labels.
+// Anything else is reported as "other" so clients cannot blow up the
+// label cardinality with made-up method names.
+var knownMethods = map[string]bool{
+	"web3_clientVersion": true, "web3_sha3": true,
+	"net_version": true, "net_listening": true, "net_peerCount": true,
+	"eth_protocolVersion": true, "eth_syncing": true, "eth_coinbase": true,
+	"eth_chainId": true, "eth_mining": true, "eth_hashrate": true,
+	"eth_gasPrice": true, "eth_maxPriorityFeePerGas": true, "eth_feeHistory": true,
+	"eth_blobBaseFee": true, "eth_accounts": true, "eth_blockNumber": true,
+	"eth_getBalance": true, "eth_getStorageAt": true, "eth_getTransactionCount": true,
+	"eth_getBlockTransactionCountByHash": true, "eth_getBlockTransactionCountByNumber": true,
+	"eth_getUncleCountByBlockHash": true, "eth_getUncleCountByBlockNumber": true,
+	"eth_getCode": true, "eth_sign": true, "eth_signTransaction": true,
+	"eth_sendTransaction": true, "eth_sendRawTransaction": true, "eth_call": true,
+	"eth_estimateGas": true, "eth_createAccessList": true, "eth_getBlockByHash": true,
+	"eth_getBlockByNumber": true, "eth_getBlockReceipts": true,
+	"eth_getTransactionByHash": true, "eth_getTransactionByBlockHashAndIndex": true,
+	"eth_getTransactionByBlockNumberAndIndex": true, "eth_getTransactionReceipt": true,
+	"eth_getUncleByBlockHashAndIndex": true, "eth_getUncleByBlockNumberAndIndex": true,
+	"eth_newFilter": true, "eth_newBlockFilter": true, "eth_newPendingTransactionFilter": true,
+	"eth_uninstallFilter": true, "eth_getFilterChanges": true, "eth_getFilterLogs": true,
+	"eth_getLogs": true, "eth_getProof": true, "eth_subscribe": true, "eth_unsubscribe": true,
+	"debug_traceTransaction": true, "debug_traceCall": true, "debug_traceBlockByNumber": true,
+	"debug_traceBlockByHash": true, "trace_block": true, "trace_transaction": true,
+	"trace_filter": true, "trace_call": true, "txpool_status": true, "txpool_content": true,
+}
+
+// MethodLabel maps a JSON-RPC method name to a bounded metric label value.
+func MethodLabel(method string) string {
+	if knownMethods[method] {
+		return method
+	}
+	return MethodLabelOther
+}
@@ -19,6 +19,45 @@ var (
 		Help: "Total number of HTTP requests.",
 	}, []string{"method", "status_code", "endpoint"}) // Added endpoint label
 
+	// RpcGatewayResponseBytes counts bytes sent to clients before compression.
+	RpcGatewayResponseBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rpc_gateway_response_bytes_total",
+		Help: "Total response body bytes sent to clients, before compression.",
+	}, []string{"endpoint", "method"})
+
+	// RpcGatewaySentBytes counts bytes sent to clients after compression.
+	RpcGatewaySentBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rpc_gateway_response_sent_bytes_total",
+		Help: "Total response body bytes sent to clients, after compression.",
+	}, []string{"endpoint", "method"})
+
+	// RpcUpstreamResponseBytes counts bytes received from upstream endpoints.
+	RpcUpstreamResponseBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rpc_gateway_upstream_response_bytes_total",
+		Help: "Total response body bytes received from upstream endpoints while proxying.",
+	}, []string{"endpoint", "method"})
+
+	// RpcRequestSizeBytes observes client request body sizes.
+	RpcRequestSizeBytes = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "rpc_gateway_request_size_bytes",
+		Help:    "Size of client request bodies in bytes.",
+		Buckets: SizeBuckets,
+	}, []string{"method", "chain"})
+
+	// RpcResponseSizeBytes observes the size of response bodies sent to
+	// clients before compression.
+	RpcResponseSizeBytes = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "rpc_gateway_response_size_bytes",
+		Help:    "Size of response bodies sent to clients in bytes, before compression.",
+		Buckets: SizeBuckets,
+	}, []string{"method", "chain"})
+
+	// RpcRequestBuffersTotal counts buffered request bodies by how they were stored.
+	RpcRequestBuffersTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rpc_gateway_request_buffers_total",
+		Help: "Total number of buffered request bodies by kind (memory, pooled, pool_miss, spill).",
+	}, []string{"kind"})
+
 	// RpcCheckDuration measures RPC health check duration.
 	RpcCheckDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
 		Name:    "rpc_gateway_rpc_check_duration_seconds",
@@ -38,6 +77,24 @@ var (
 		Help: "Total number of rate limits detected.",
 	}, []string{"endpoint", "source"}) // Source: 'check' or 'proxy'
 
+	// RpcMethodRateLimitedTotal counts client calls rejected by per-method rate limits.
+	RpcMethodRateLimitedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rpc_gateway_method_rate_limited_total",
+		Help: "Total number of client requests rejected by a per-method rate limit.",
+	}, []string{"method", "chain"}) // Configured method or pattern, keeps cardinality bounded
+
+	// RpcDeniedMethodCallsTotal counts client calls refused by methodFilter.
+	RpcDeniedMethodCallsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rpc_gateway_denied_method_calls_total",
+		Help: "Total number of client calls refused by methodFilter, by method.",
+	}, []string{"method", "chain"})
+
+	// RpcClientRateLimitedTotal counts requests rejected by the per-client rate limit.
+	RpcClientRateLimitedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rpc_gateway_client_rate_limited_total",
+		Help: "Total number of requests rejected by the per-client rate limit, by client IP.",
+	}, []string{"ip", "chain"}) // Only limited clients get a series
+
 	// RpcEndpointBlockNumber shows the current block number per endpoint.
 	RpcEndpointBlockNumber = promauto.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "rpc_gateway_rpc_endpoint_block_number",
@@ -50,22 +107,350 @@ var (
 		Help: "Current latency for each RPC endpoint.",
 	}, []string{"endpoint"})
 
+	// RpcEndpointLatencyEWMA shows the smoothed latency selection ranks endpoints by.
+	RpcEndpointLatencyEWMA = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rpc_gateway_rpc_endpoint_latency_ewma_seconds",
+		Help: "Exponentially weighted moving average of the latency for each RPC endpoint.",
+	}, []string{"endpoint"})
+
+	// RpcEndpointQuotaRemaining shows the remaining request quota reported by each endpoint.
+	RpcEndpointQuotaRemaining = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rpc_gateway_rpc_endpoint_quota_remaining",
+		Help: "Remaining request quota reported by each RPC endpoint's rate-limit headers.",
+	}, []string{"endpoint"})
+
 	// RpcEndpointIsActive shows if an endpoint is considered active (1) or not (0).
 	RpcEndpointIsActive = promauto.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "rpc_gateway_rpc_endpoint_is_active",
 		Help: "Whether an endpoint is currently considered active (1) or inactive (0).",
 	}, []string{"endpoint"})
 
+	// RpcServingRegion marks the region of the current best endpoint with 1.
+	RpcServingRegion = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rpc_gateway_serving_region",
+		Help: "Region of the endpoint currently serving traffic (1 for the serving region).",
+	}, []string{"region", "chain"})
+
+	// RpcEndpointCredentialError shows if an endpoint rejected our credentials (1) or not (0).
+	RpcEndpointCredentialError = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rpc_gateway_rpc_endpoint_credential_error",
+		Help: "Whether an endpoint is disabled because it rejected our credentials with HTTP 401/403 (1) or not (0).",
+	}, []string{"endpoint"})
+
+	// RpcHedgedRequestsTotal counts hedged requests by which attempt answered.
+	RpcHedgedRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rpc_gateway_hedged_requests_total",
+		Help: "Total number of requests hedged to a second endpoint, by winning attempt (primary, hedge, none).",
+	}, []string{"endpoint", "winner"})
+
+	// RpcEndpointHealthScore exposes the 0-100 health score of each endpoint.
+	RpcEndpointHealthScore = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rpc_gateway_rpc_endpoint_health_score",
+		Help: "Health score of an endpoint from 0 (unusable) to 100 (best), combining reachability, latency, block lag, error rate and rate limiting.",
+	}, []string{"endpoint"})
+
+	// RpcUpstreamResetTotal counts responses cut off by the upstream after the
+	// headers were already sent to the client.
+	RpcUpstreamResetTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rpc_gateway_upstream_reset_total",
+		Help: "Total number of upstream responses that failed mid-stream, after the status and headers were sent to the client.",
+	}, []string{"endpoint"})
+
+	// RpcEndpointEffectiveWeight exposes each endpoint's weight after error-rate decay.
+	RpcEndpointEffectiveWeight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rpc_gateway_rpc_endpoint_effective_weight",
+		Help: "Weight of an endpoint after decay by its recent error rate.",
+	}, []string{"endpoint"})
+
+	// RpcEndpointIsSyncing shows if an endpoint reports an ongoing sync (1) or not (0).
+	RpcEndpointIsSyncing = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rpc_gateway_rpc_endpoint_is_syncing",
+		Help: "Whether an endpoint reports via eth_syncing that it is still syncing (1) or not (0).",
+	}, []string{"endpoint"})
+
+	// RpcEndpointBlockStale shows if an endpoint's block height is stale (1) or not (0).
+	RpcEndpointBlockStale = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rpc_gateway_rpc_endpoint_block_stale",
+		Help: "Whether an endpoint's block height has not advanced for maxBlockStaleness while other endpoints moved on (1) or not (0).",
+	}, []string{"endpoint"})
+
+	// RpcEndpointRpcErrorRate tracks the share of JSON-RPC error replies per endpoint.
+	RpcEndpointRpcErrorRate = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rpc_gateway_rpc_endpoint_rpc_error_rate",
+		Help: "Share of JSON-RPC error replies among an endpoint's recent replies, between 0 and 1.",
+	}, []string{"endpoint"})
+
+	// RpcEndpointErrorDemoted shows if an endpoint is demoted for its JSON-RPC error rate (1) or not (0).
+	RpcEndpointErrorDemoted = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rpc_gateway_rpc_endpoint_error_demoted",
+		Help: "Whether an endpoint's JSON-RPC error rate exceeds maxErrorRate, ranking it after all others (1) or not (0).",
+	}, []string{"endpoint"})
+
 	// RpcEndpointIsCurrentBest shows if an endpoint is the current best (1) or not (0).
 	RpcEndpointIsCurrentBest = promauto.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "rpc_gateway_rpc_endpoint_is_current_best",
 		Help: "Whether an endpoint is the current best choice (1) or not (0).",
 	}, []string{"endpoint"})
+
+	// RpcDegradedSelectionTotal counts selection passes with fewer than minCandidates healthy endpoints.
+	RpcDegradedSelectionTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rpc_gateway_degraded_selection_total",
+		Help: "Total number of selection passes that found fewer healthy endpoints than minCandidates.",
+	}, []string{"chain"})
+
+	// RpcCurrentBestInfo has a single series per gateway, labelled with the
+	// current best endpoint.
+	RpcCurrentBestInfo = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rpc_gateway_current_best_info",
+		Help: "Always 1, labelled with the current best endpoint. The series moves to the new best on every change and is absent while no endpoint is healthy.",
+	}, []string{"endpoint"})
+
+	// RpcBlockTagActionsTotal counts block tag parameters rejected or rewritten.
+	RpcBlockTagActionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rpc_gateway_block_tag_actions_total",
+		Help: "Total number of block tag parameters rejected or rewritten by the blockTags rules.",
+	}, []string{"method", "tag", "action", "chain"})
+
+	// RpcSelectionCompleteness is the share of health checks that had
+	// completed when a selection pass first chose a best endpoint.
+	RpcSelectionCompleteness = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rpc_gateway_selection_completeness_ratio",
+		Help: "Fraction (0-1) of endpoint checks completed when the last selection pass first chose a best endpoint.",
+	}, []string{"chain"})
+
+	// RpcSelectionDuration measures how long selection passes take to choose
+	// a best endpoint.
+	RpcSelectionDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "rpc_gateway_selection_duration_seconds",
+		Help:    "Time from the start of a selection pass until it first chose a best endpoint.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"chain"})
+
+	// RpcRetryBudgetExhaustedTotal counts retries and failovers skipped as the retry budget was spent.
+	RpcRetryBudgetExhaustedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rpc_gateway_retry_budget_exhausted_total",
+		Help: "Total number of retries and failovers not attempted because the retry budget was exhausted.",
+	}, []string{"chain"})
+
+	// RpcProxyRetriesTotal counts retried upstream attempts by their outcome.
+	RpcProxyRetriesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rpc_gateway_proxy_retries_total",
+		Help: "Total number of retried upstream attempts, by endpoint and outcome (success, failure, and failover_success, failover_failure for attempts failed over to another endpoint).",
+	}, []string{"endpoint", "outcome"})
+
+	// RpcEndpointAgreement shows whether two endpoints returned the same
+	// result in the last agreement monitor round.
+	RpcEndpointAgreement = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rpc_gateway_endpoint_agreement",
+		Help: "Whether the endpoint pair agreed in the last agreement monitor round (1 = same result, 0 = different).",
+	}, []string{"endpoint", "peer"})
+
+	// RpcEndpointAgreementTotal counts agreement monitor comparisons per
+	// endpoint pair, so the agreement rate can be computed over any window.
+	RpcEndpointAgreementTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rpc_gateway_endpoint_agreement_total",
+		Help: "Total number of agreement monitor comparisons per endpoint pair, by result (agree, disagree).",
+	}, []string{"endpoint", "peer", "result"})
+
+	// RpcOversizedHeadersTotal counts client requests rejected for their
+	// header size.
+	RpcOversizedHeadersTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rpc_gateway_oversized_headers_total",
+		Help: "Total number of client requests rejected because their headers exceeded clientHeaders.maxBytes.",
+	}, []string{"chain"})
+
+	// RpcOversizedRequestsTotal counts client requests rejected for their
+	// body size.
+	RpcOversizedRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rpc_gateway_oversized_requests_total",
+		Help: "Total number of client requests rejected because their body exceeded maxRequestBytes.",
+	}, []string{"chain"})
+
+	// RpcBestEndpointChangesTotal counts switches of the best endpoint.
+	RpcBestEndpointChangesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rpc_gateway_best_endpoint_changes_total",
+		Help: "Total number of times the best endpoint changed, by the newly selected endpoint.",
+	}, []string{"endpoint"})
+
+	// RpcIncumbentRetainedTotal counts selections where the incumbency
+	// discount kept the current best ahead of a faster runner-up.
+	RpcIncumbentRetainedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rpc_gateway_incumbent_retained_total",
+		Help: "Total number of selection passes in which incumbentDiscount kept the current best endpoint that would otherwise have been replaced.",
+	}, []string{"chain"})
+
+	// RpcDwellHoldsTotal counts selection passes held back by minDwell.
+	RpcDwellHoldsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rpc_gateway_dwell_holds_total",
+		Help: "Total number of selection passes in which minDwell kept a recently promoted, still healthy best endpoint that would otherwise have been replaced.",
+	}, []string{"chain"})
+
+	// RpcEndpointCostTotal accumulates the estimated cost of the calls sent
+	// to each endpoint, health checks included.
+	RpcEndpointCostTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rpc_gateway_rpc_endpoint_cost_total",
+		Help: "Estimated cost incurred per endpoint: calls sent (proxied and health checks) times costPerRequest.",
+	}, []string{"endpoint"})
+
+	// RpcEndpointPeerCount shows each endpoint's net_peerCount.
+	RpcEndpointPeerCount = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rpc_gateway_rpc_endpoint_peer_count",
+		Help: "Peer count reported by net_peerCount (txRouting only).",
+	}, []string{"endpoint"})
+
+	// RpcEndpointTxReady shows whether an endpoint passes the txRouting checks.
+	RpcEndpointTxReady = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rpc_gateway_rpc_endpoint_tx_ready",
+		Help: "Whether the endpoint passes the txRouting checks for transaction submission (1 = yes, 0 = no).",
+	}, []string{"endpoint"})
+
+	// RpcTxReroutedTotal counts transaction submissions sent to an endpoint
+	// other than the current best because of the txRouting checks.
+	RpcTxReroutedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rpc_gateway_tx_rerouted_total",
+		Help: "Total number of transaction submissions routed away from the current best endpoint, by the endpoint chosen instead.",
+	}, []string{"endpoint"})
+
+	// RpcCanaryRequestsTotal counts requests routed to the canary endpoint.
+	RpcCanaryRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rpc_gateway_canary_requests_total",
+		Help: "Total number of read-only requests routed to the canary endpoint.",
+	}, []string{"chain"})
+
+	// RpcCanaryErrorRate shows the canary's error rate over its error window.
+	RpcCanaryErrorRate = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rpc_gateway_canary_error_rate",
+		Help: "Share of failed checks and requests of the canary endpoint over its error window.",
+	}, []string{"chain"})
+
+	// RpcCanaryActive shows whether the canary still receives traffic.
+	RpcCanaryActive = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rpc_gateway_canary_active",
+		Help: "Whether the canary endpoint receives traffic (1) or was rolled back (0).",
+	}, []string{"chain"})
+
+	// GatewayConnections shows the open client connections of the gateway
+	// listener while listener.maxConnections is set.
+	GatewayConnections = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "rpc_gateway_listener_connections",
+		Help: "Open client connections on the gateway listener (tracked when listener.maxConnections is set).",
+	})
+
+	// GatewayRejectedConnectionsTotal counts connections closed because the
+	// gateway listener was at listener.maxConnections.
+	GatewayRejectedConnectionsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "rpc_gateway_listener_rejected_connections_total",
+		Help: "Total number of client connections closed on accept because listener.maxConnections was reached.",
+	})
+
+	// RpcRoutingRuleRequestsTotal counts requests handled by routing rules.
+	RpcRoutingRuleRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rpc_gateway_routing_rule_requests_total",
+		Help: "Total number of requests matched by a routing rule, by rule expression and outcome (matched, fallback, unmatched).",
+	}, []string{"rule", "outcome", "chain"})
+
+	// RpcResponseTransformsTotal counts responses rewritten by response transforms.
+	RpcResponseTransformsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rpc_gateway_response_transforms_total",
+		Help: "Total number of JSON-RPC results passed through response transforms, by method and outcome (applied, error).",
+	}, []string{"method", "outcome", "chain"})
+
+	// RpcVariantRequestsTotal counts requests per A/B variant.
+	RpcVariantRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rpc_gateway_variant_requests_total",
+		Help: "Total number of proxied requests by variant header value (\"default\" when absent or unknown) and status code.",
+	}, []string{"variant", "status_code", "chain"})
+
+	// RpcVariantRequestDuration tracks request latency per A/B variant.
+	RpcVariantRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "rpc_gateway_variant_request_duration_seconds",
+		Help:    "Duration of proxied requests by variant.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"variant", "chain"})
+
+	// RpcNormalizedResponsesTotal counts responses repaired by normalizeResponses.
+	RpcNormalizedResponsesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rpc_gateway_normalized_responses_total",
+		Help: "Total number of upstream responses that were missing the jsonrpc member or a reply id and were repaired.",
+	}, []string{"chain"})
+
+	// RpcEndpointUptimePercent is each endpoint's health-check uptime.
+	RpcEndpointUptimePercent = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rpc_gateway_endpoint_uptime_percent",
+		Help: "Share of passed health checks over uptime.window, 0-100.",
+	}, []string{"endpoint"})
+	// RpcWebSocketConnections counts open WebSocket connections per endpoint.
+	RpcWebSocketConnections = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rpc_gateway_websocket_connections",
+		Help: "Number of open proxied WebSocket connections per endpoint.",
+	}, []string{"endpoint"})
+	// RpcEndpointCircuitState shows an endpoint's circuit breaker state, see
+	// CircuitClosed and friends.
+	RpcEndpointCircuitState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rpc_gateway_rpc_endpoint_circuit_state",
+		Help: "Circuit breaker state of an endpoint: 0 closed, 1 open, 2 half-open.",
+	}, []string{"endpoint"})
+	// RpcCacheHitsTotal counts requests answered from the response cache.
+	RpcCacheHitsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rpc_gateway_cache_hits_total",
+		Help: "Total number of cacheable requests answered from the response cache, by method.",
+	}, []string{"method", "chain"})
+
+	// RpcCacheMissesTotal counts cacheable requests that were forwarded.
+	RpcCacheMissesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rpc_gateway_cache_misses_total",
+		Help: "Total number of cacheable requests not found in the response cache, by method.",
+	}, []string{"method", "chain"})
+	// RpcEndpointOutlierTotal counts selection passes that excluded an
+	// endpoint for reporting a block beyond the blockQuorum height.
+	RpcEndpointOutlierTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rpc_gateway_rpc_endpoint_outlier_total",
+		Help: "Selection passes that excluded an endpoint for reporting a block ahead of the quorum height.",
+	}, []string{"endpoint"})
+	// RpcHealthyEndpoints is the number of selection candidates found by the
+	// last complete selection pass.
+	RpcHealthyEndpoints = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rpc_gateway_healthy_endpoints",
+		Help: "Healthy endpoints found by the last selection pass.",
+	}, []string{"chain"})
+	// RpcNoEndpointsTotal counts selection passes that found no healthy endpoint.
+	RpcNoEndpointsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rpc_gateway_no_endpoints_total",
+		Help: "Selection passes that found no healthy endpoint.",
+	}, []string{"chain"})
+
+	// RpcUpstreamResponsesTotal counts proxied upstream responses by status code.
+	RpcUpstreamResponsesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rpc_gateway_upstream_responses_total",
+		Help: "Total number of responses received from upstream endpoints while proxying, by endpoint and HTTP status code.",
+	}, []string{"endpoint", "status_code"})
+
+	// ConfigReloadsTotal counts SIGHUP-triggered configuration reloads.
+	ConfigReloadsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rpc_gateway_config_reloads_total",
+		Help: "Total number of configuration reloads triggered by SIGHUP, by result.",
+	}, []string{"result"}) // 'success' or 'failure'
+
+	// ConfigLastReloadTimestamp is the time the configuration in effect was loaded.
+	ConfigLastReloadTimestamp = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "rpc_gateway_config_last_reload_timestamp",
+		Help: "Unix time in seconds of the last successful configuration load, at startup or on SIGHUP.",
+	})
 )
 
+// SizeBuckets are the byte-size histogram buckets: 64B up to 64MB in x4 steps.
+var SizeBuckets = prometheus.ExponentialBuckets(64, 4, 11)
+
 var RpcEndpointCurrentBestActive float64 = 1
 var RpcEndpointCurrentBestNotActive float64 = 0
 
+// Values of RpcEndpointCircuitState.
+const (
+	CircuitClosed   float64 = 0
+	CircuitOpen     float64 = 1
+	CircuitHalfOpen float64 = 2
+)
+
 // InitMetrics - We don't strictly need an Init function when using promauto,
 // as metrics are registered on creation. This is kept for conceptual clarity
 // or if we switch from promauto later.
@@ -73,3 +458,18 @@ func InitMetrics() {
 	// promauto handles registration, so this can be empty
 	// or used for more complex setup if needed.
 }
+
+// DeleteEndpoint removes the gauge series of an endpoint that is no longer
+// configured, so dashboards do not keep showing its last values.
+func DeleteEndpoint(endpointURL string) {
+	for _, gauge := range []*prometheus.GaugeVec{
+		RpcEndpointBlockNumber, RpcEndpointLatency, RpcEndpointQuotaRemaining,
+		RpcEndpointIsActive, RpcEndpointCredentialError, RpcEndpointHealthScore,
+		RpcEndpointEffectiveWeight, RpcEndpointIsSyncing, RpcEndpointIsCurrentBest,
+		RpcEndpointPeerCount, RpcEndpointTxReady, RpcEndpointUptimePercent,
+		RpcEndpointCircuitState, RpcEndpointLatencyEWMA, RpcEndpointBlockStale,
+		RpcEndpointRpcErrorRate, RpcEndpointErrorDemoted, RpcCurrentBestInfo,
+	} {
+		gauge.DeleteLabelValues(endpointURL)
+	}
+}
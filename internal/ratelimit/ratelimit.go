@@ -0,0 +1,111 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// idleTimeout is how long an unused bucket is kept before it is evicted.
+const idleTimeout = 10 * time.Minute
+
+// Limiter is a set of token buckets sharing one rate and burst, keyed by an
+// arbitrary string such as a method name or client IP.
+type Limiter struct {
+	limit     rate.Limit
+	burst     int
+	mutex     sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// New creates a Limiter allowing requestsPerSecond per key with the given burst.
+func New(requestsPerSecond float64, burst int) *Limiter {
+	return &Limiter{
+		limit:     rate.Limit(requestsPerSecond),
+		burst:     burst,
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// Allow reports whether one request for key may proceed now, consuming a
+// token if so.
+func (l *Limiter) Allow(key string) bool {
+	_, ok := l.Take(key)
+	return ok
+}
+
+// Take consumes a token for key if one is available now. Otherwise it
+// returns false and how long the caller should wait for the next token.
+func (l *Limiter) Take(key string) (time.Duration, bool) {
+	_, delay, ok := l.reserve(key, 1)
+	return delay, ok
+}
+
+// Reservation holds tokens consumed by Reserve.
+type Reservation struct {
+	reservation *rate.Reservation
+	at          time.Time
+}
+
+// Cancel returns the reserved tokens, as far as later reservations allow.
+// It cancels as of the reservation time: rate.Reservation.Cancel keeps
+// tokens that were usable before it was called, as immediate ones are.
+func (r *Reservation) Cancel() {
+	r.reservation.CancelAt(r.at)
+}
+
+// Reserve consumes n tokens for key if all of them are available now. A
+// caller checking several limits can Cancel the reservations it made when a
+// later limit rejects the request.
+func (l *Limiter) Reserve(key string, n int) (*Reservation, bool) {
+	reservation, _, ok := l.reserve(key, n)
+	return reservation, ok
+}
+
+// reserve consumes n tokens for key if they are available now. Otherwise it
+// returns false and how long the caller should wait for them.
+func (l *Limiter) reserve(key string, n int) (*Reservation, time.Duration, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.lastSweep) > idleTimeout {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.buckets[key] = b
+	}
+	b.lastSeen = now
+	reservation := b.limiter.ReserveN(now, n)
+	if !reservation.OK() {
+		return nil, 0, false // More than the burst is never admitted
+	}
+	if delay := reservation.DelayFrom(now); delay > 0 {
+		reservation.CancelAt(now)
+		return nil, delay, false
+	}
+	return &Reservation{reservation: reservation, at: now}, 0, true
+}
+
+// sweep evicts buckets that have not been used recently; a key that comes
+// back later starts again with a full burst.
+// The caller must hold l.mutex.
+func (l *Limiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if now.Sub(b.lastSeen) > idleTimeout {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
@@ -0,0 +1,57 @@
+// Package tracing exports OpenTelemetry spans to an OTLP collector. Until
+// Setup installs an exporter, the global no-op tracer provider stays in
+// place, so spans started through Tracer cost next to nothing.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"rpc-load-balancer/internal/config"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracer starts the gateway's spans. It delegates to the provider installed
+// by Setup, or to the no-op one without tracing.
+var Tracer = otel.Tracer("rpc-load-balancer")
+
+// Setup installs an OTLP/HTTP exporter as the global tracer provider and the
+// W3C trace context propagator, so traces continue from clients to the
+// upstreams. It returns a function that flushes pending spans on shutdown.
+// Without an endpoint configured it does nothing.
+func Setup(ctx context.Context, cfg config.TracingConfig) (func(context.Context) error, error) {
+	if cfg.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter for %s: %w", cfg.Endpoint, err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", cfg.ServiceName))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return provider.Shutdown, nil
+}
+
+// StartServerSpan starts the span of an incoming request, continuing the
+// client's trace when the request carries a trace context.
+func StartServerSpan(r *http.Request, name string) (context.Context, trace.Span) {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	return Tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer))
+}
+
+// Inject adds the trace context of ctx to the headers of an outgoing request.
+func Inject(ctx context.Context, header http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+}
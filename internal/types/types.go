@@ -1,7 +1,10 @@
 package types
 
 import (
+	"encoding/json"
+	"net/http"
 	"net/url"
+	"rpc-load-balancer/internal/config"
 	"sync"
 	"time"
 )
@@ -9,29 +12,195 @@ import (
 // RpcEndpoint holds the state and details of a single upstream RPC node.
 type RpcEndpoint struct {
 	URL              *url.URL
+	WsURL            *url.URL // WebSocket upstream, nil without a wsUrl
 	BlockNumber      int64
 	Latency          time.Duration
+	LatencyEWMA      time.Duration // Smoothed latency candidates are ranked by, 0 until measured
 	IsRateLimited    bool
 	RateLimitedUntil time.Time
+	RateLimitStreak  int // Consecutive rate limits, doubling the backoff
 	IsReachable      bool
-	Mutex            sync.RWMutex
-}
-
-// EthBlockNumberRequest defines the JSON structure for the eth_blockNumber request.
-type EthBlockNumberRequest struct {
-	Jsonrpc string `json:"jsonrpc"`
-	Method  string `json:"method"`
-	Params  []any  `json:"params"`
-	ID      int    `json:"id"`
-}
-
-// EthBlockNumberResponse defines the JSON structure for the eth_blockNumber response.
-type EthBlockNumberResponse struct {
-	Jsonrpc string `json:"jsonrpc"`
-	Result  string `json:"result"`
-	Error   *struct {
-		Code    int    `json:"code"`
-		Message string `json:"message"`
-	} `json:"error"`
-	ID int `json:"id"`
+	IsSyncing        bool  // eth_syncing reported an ongoing sync
+	PeerCount        int64 // net_peerCount result, -1 until known
+	ChainID          int64 // eth_chainId result from the startup check, 0 until known
+	TxReady          bool  // Passes the txRouting checks for transaction submission
+	QuotaRemaining   int64 // -1 until the upstream reports a quota header
+	BlockOutlier     bool  // Ahead of the blockQuorum height, excluded from selection
+	// HasCredentialError is set when the endpoint rejects our credentials
+	// (HTTP 401/403). It is distinct from being unreachable.
+	HasCredentialError bool
+	CredentialRetryAt  time.Time
+	// BlockAdvancedAt is the last time BlockNumber increased. BlockStale is
+	// set while it has not for maxBlockStaleness as other endpoints moved on.
+	BlockAdvancedAt time.Time
+	BlockStale      bool
+	// ProxyFailures counts consecutive failed proxied requests for the
+	// circuit breaker, which sets CircuitOpenUntil while the circuit is open.
+	ProxyFailures    int
+	CircuitOpenUntil time.Time
+	// ErrorRate is the share of failures among the recent health checks and
+	// proxied requests kept in Outcomes, between 0 and 1.
+	ErrorRate float64
+	Outcomes  OutcomeWindow
+	// RpcErrorRate is the share of JSON-RPC error replies among the recent
+	// proxied replies and passed health checks kept in RpcOutcomes.
+	// RpcErrorDemoted is set while it exceeds maxErrorRate.
+	RpcErrorRate    float64
+	RpcOutcomes     OutcomeWindow
+	RpcErrorDemoted bool
+	// Uptime is the share of passed health checks over uptime.window
+	Uptime      UptimeWindow
+	UptimeRatio float64 // Last Uptime.Ratio, 1 until known
+	// EffectiveWeight is the configured weight scaled down by ErrorRate.
+	EffectiveWeight float64
+	HealthScore     float64         // 0-100, see gateway.updateHealthScores
+	Tags            map[string]bool // Config tags plus "region:<region>", for routingRules
+	Config          config.EndpointConfig
+	// Headers are set on every request sent to the endpoint: its configured
+	// headers and basic auth credentials
+	Headers http.Header
+	// Transport is set when the endpoint needs its own HTTP transport
+	// (e.g. custom TLS settings); nil means the gateway's shared one.
+	Transport *http.Transport
+	Mutex     sync.RWMutex
+}
+
+// OutcomeWindow is a sliding window over the results of the most recent calls
+// to an endpoint.
+type OutcomeWindow struct {
+	failed   []bool
+	next     int
+	count    int
+	failures int
+}
+
+// NewOutcomeWindow creates a window remembering the last size outcomes.
+func NewOutcomeWindow(size int) OutcomeWindow {
+	return OutcomeWindow{failed: make([]bool, size)}
+}
+
+// Add records an outcome, evicting the oldest one once the window is full.
+func (w *OutcomeWindow) Add(failed bool) {
+	if len(w.failed) == 0 {
+		return
+	}
+	if w.count == len(w.failed) {
+		if w.failed[w.next] {
+			w.failures--
+		}
+	} else {
+		w.count++
+	}
+	w.failed[w.next] = failed
+	if failed {
+		w.failures++
+	}
+	w.next = (w.next + 1) % len(w.failed)
+}
+
+// Clone returns an independent copy of the window.
+func (w *OutcomeWindow) Clone() OutcomeWindow {
+	c := *w
+	c.failed = append([]bool(nil), w.failed...)
+	return c
+}
+
+// Len returns the number of outcomes in the window.
+func (w *OutcomeWindow) Len() int {
+	return w.count
+}
+
+// Rate returns the share of failures in the window, 0 when it is empty.
+func (w *OutcomeWindow) Rate() float64 {
+	if w.count == 0 {
+		return 0
+	}
+	return float64(w.failures) / float64(w.count)
+}
+
+// uptimeBuckets is the number of time buckets an UptimeWindow is split into.
+const uptimeBuckets = 60
+
+// UptimeWindow tracks the share of passed health checks over a sliding time
+// window. Checks are counted in fixed time buckets, so the window advances in
+// steps of a sixtieth of its length.
+type UptimeWindow struct {
+	buckets []uptimeBucket
+	span    time.Duration // Length of one bucket
+}
+
+type uptimeBucket struct {
+	start     time.Time
+	up, total int
+}
+
+// NewUptimeWindow creates a window covering the given duration.
+func NewUptimeWindow(window time.Duration) UptimeWindow {
+	return UptimeWindow{
+		buckets: make([]uptimeBucket, uptimeBuckets),
+		span:    max(window/uptimeBuckets, time.Second),
+	}
+}
+
+// Add records the result of a health check made at now.
+func (w *UptimeWindow) Add(now time.Time, up bool) {
+	if len(w.buckets) == 0 {
+		return
+	}
+	start := now.Truncate(w.span)
+	b := &w.buckets[int(start.UnixNano()/int64(w.span))%len(w.buckets)]
+	if !b.start.Equal(start) {
+		*b = uptimeBucket{start: start}
+	}
+	b.total++
+	if up {
+		b.up++
+	}
+}
+
+// Clone returns an independent copy of the window.
+func (w *UptimeWindow) Clone() UptimeWindow {
+	c := *w
+	c.buckets = append([]uptimeBucket(nil), w.buckets...)
+	return c
+}
+
+// Ratio returns the share of passed checks within the window ending at now,
+// and false when no check was recorded in it.
+func (w *UptimeWindow) Ratio(now time.Time) (float64, bool) {
+	window := w.span * time.Duration(len(w.buckets))
+	up, total := 0, 0
+	for _, b := range w.buckets {
+		if b.total > 0 && now.Sub(b.start) < window {
+			up += b.up
+			total += b.total
+		}
+	}
+	if total == 0 {
+		return 0, false
+	}
+	return float64(up) / float64(total), true
+}
+
+// JsonRpcRequest defines a single JSON-RPC call as sent by clients.
+// ID is kept raw so a missing id (a notification) can be told apart from null.
+type JsonRpcRequest struct {
+	Jsonrpc string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+}
+
+// JsonRpcResponse defines a single JSON-RPC response.
+type JsonRpcResponse struct {
+	Jsonrpc string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *JsonRpcError   `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// JsonRpcError defines the error object of a JSON-RPC response.
+type JsonRpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
 }
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"io"
 	"net"
 	"net/http"
 	"strings"
@@ -25,13 +26,14 @@ func GetRequestIP(r *http.Request) string {
 
 type loggingResponseWriter struct {
 	http.ResponseWriter
-	StatusCode int
+	StatusCode   int
+	BytesWritten int64
 }
 
 // NewLoggingResponseWriter creates a new loggingResponseWriter.
 func NewLoggingResponseWriter(w http.ResponseWriter) *loggingResponseWriter {
 	// Default status code is 200 (OK) if WriteHeader is never called.
-	return &loggingResponseWriter{w, http.StatusOK}
+	return &loggingResponseWriter{ResponseWriter: w, StatusCode: http.StatusOK}
 }
 
 // WriteHeader captures the status code before calling the original WriteHeader.
@@ -45,5 +47,36 @@ func (lrw *loggingResponseWriter) WriteHeader(code int) {
 func (lrw *loggingResponseWriter) Write(b []byte) (int, error) {
 	// If WriteHeader has not been called, Write will call WriteHeader(http.StatusOK)
 	// We don't need to explicitly capture it here as WriteHeader handles it.
-	return lrw.ResponseWriter.Write(b)
+	n, err := lrw.ResponseWriter.Write(b)
+	lrw.BytesWritten += int64(n)
+	return n, err
+}
+
+// Unwrap returns the original ResponseWriter, so http.ResponseController can
+// reach optional interfaces such as http.Flusher.
+func (lrw *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return lrw.ResponseWriter
+}
+
+// CountingReadCloser counts the bytes read through it, calling OnRead with
+// the size of every successful read. If OnError is set it is called once for
+// the first read error other than io.EOF.
+type CountingReadCloser struct {
+	io.ReadCloser
+	OnRead  func(n int)
+	OnError func(err error)
+	failed  bool
+}
+
+// Read reads from the wrapped reader and reports the bytes read.
+func (c *CountingReadCloser) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	if n > 0 {
+		c.OnRead(n)
+	}
+	if err != nil && err != io.EOF && c.OnError != nil && !c.failed {
+		c.failed = true
+		c.OnError(err)
+	}
+	return n, err
 }
@@ -4,12 +4,17 @@ import (
 	"context"
 	"errors"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"rpc-load-balancer/internal/config"
 	"rpc-load-balancer/internal/gateway"
+	"rpc-load-balancer/internal/listener"
+	"rpc-load-balancer/internal/logging"
 	"rpc-load-balancer/internal/metrics"
+	"rpc-load-balancer/internal/tracing"
+	"slices"
 	"syscall"
 	"time"
 )
@@ -17,70 +22,339 @@ import (
 const configFilename = "config.yaml"
 
 func main() {
+	// "validate" (or --validate) checks the configuration and endpoints and
+	// exits instead of serving
+	if len(os.Args) > 1 && (os.Args[1] == "validate" || os.Args[1] == "--validate") {
+		os.Exit(validate())
+	}
+
 	log.Println("Starting RPC Gateway...")
 
 	// Load configuration from YAML file
 	if err := config.LoadConfig(configFilename); err != nil {
 		log.Fatalf("Fatal: Failed to load configuration: %v", err)
 	}
+	metrics.ConfigLastReloadTimestamp.SetToCurrentTime()
+	// Export both results from the start, so rate() and increase() see the
+	// first reload instead of a series appearing at 1
+	for _, result := range []string{"success", "failure"} {
+		metrics.ConfigReloadsTotal.WithLabelValues(result)
+	}
+	logging.Setup(config.AppConfig.Verbose, config.AppConfig.LogFormat == config.LogFormatJSON)
+	logging.SetupRateLimit(config.AppConfig.LogRateLimit.Window, *config.AppConfig.LogRateLimit.Summarize)
+
+	// Load the TLS certificate up front, so a bad pair fails before startup
+	var certs *listener.CertReloader
+	if config.AppConfig.TLSCertFile != "" {
+		var err error
+		certs, err = listener.NewCertReloader(config.AppConfig.TLSCertFile, config.AppConfig.TLSKeyFile)
+		if err != nil {
+			log.Fatalf("Fatal: %v", err)
+		}
+	}
+
+	// Export spans when an OTLP collector is configured
+	shutdownTracing, err := tracing.Setup(context.Background(), config.AppConfig.Tracing)
+	if err != nil {
+		log.Fatalf("Fatal: %v", err)
+	}
+	if config.AppConfig.Tracing.Endpoint != "" {
+		log.Printf("🛰️ Exporting traces to %s (sample ratio %g)", config.AppConfig.Tracing.Endpoint, config.AppConfig.Tracing.SampleRatio)
+	}
 
-	// Initialize the gateway using the loaded config
-	gw, err := gateway.NewGateway(&config.AppConfig)
+	// Initialize the gateway using the loaded config, one per chain if
+	// chains are configured
+	gateways, err := newGateways(&config.AppConfig)
 	if err != nil {
 		log.Fatalf("Fatal: Failed to initialize gateway: %v", err)
 	}
 
+	// Refuse to balance across endpoints of different networks
+	for name, gw := range gateways {
+		if err := gw.VerifyChainConsistency(); err != nil {
+			log.Fatalf("Fatal: %s%v", chainLabel(name), err)
+		}
+	}
+
 	// Setup context for graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// Start the periodic health checker
-	gw.StartChecker(ctx)
+	// Start the periodic health checkers
+	for name, gw := range gateways {
+		gw.StartChecker(ctx)
+		gw.StartAgreementMonitor(ctx)
+
+		if !gw.HasValidatedEndpoint() {
+			switch config.AppConfig.StartupMode {
+			case config.StartupFailStartup:
+				log.Fatalf("Fatal: %sNo healthy endpoint found after the first check", chainLabel(name))
+			case config.StartupServeWith503:
+				log.Printf("⚠️ %sNo healthy endpoint yet. Answering 503 until one recovers.", chainLabel(name))
+			default:
+				log.Printf("⚠️ %sNo healthy endpoint yet. Forwarding to the first endpoint anyway.", chainLabel(name))
+			}
+		}
+	}
+
+	// Open the gateway listener with the configured socket options
+	ln, err := listener.Listen(ctx, "gateway", config.AppConfig.GatewayPort, config.AppConfig.Listener)
+	if err != nil {
+		log.Fatalf("Fatal: Failed to listen on %s: %v", config.AppConfig.GatewayPort, err)
+	}
 
 	// Setup the HTTP server
+	var handler http.Handler
+	if len(config.AppConfig.Chains) > 0 {
+		handler = gateway.ChainRouter(config.AppConfig.Chains, gateways)
+	} else {
+		handler = gateways[""].ProxyHandler()
+	}
 	server := &http.Server{
 		Addr:    config.AppConfig.GatewayPort, // Use port from config
-		Handler: gw.ProxyHandler(),
+		Handler: handler,
 	}
 
-	// Setup the metrics server (runs on a different port)
-	metricsServer := &http.Server{
-		Addr:    config.AppConfig.MetricsPort,
-		Handler: metrics.MetricsHandler(), // Use the metrics mux
+	if certs != nil {
+		server.TLSConfig = certs.TLSConfig()
 	}
 
 	// Start server in a goroutine
 	go func() {
-		log.Printf("🚀 Gateway listening on http://localhost%s", config.AppConfig.GatewayPort)
-		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		var err error
+		if certs != nil {
+			log.Printf("🚀 Gateway listening on %s", listenURL("https", config.AppConfig.GatewayPort))
+			err = server.ServeTLS(ln, "", "")
+		} else {
+			log.Printf("🚀 Gateway listening on %s", listenURL("http", config.AppConfig.GatewayPort))
+			err = server.Serve(ln)
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
 			log.Fatalf("Fatal: Server failed to start: %v", err)
 		}
 	}()
+	listeners := map[string]net.Listener{"gateway": ln}
+	var auxServers []*http.Server
 
-	// Start metrics server
-	go func() {
-		log.Printf("📊 Metrics listening on http://localhost%s/metrics", config.AppConfig.MetricsPort)
-		if err := metricsServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			log.Fatalf("Fatal: Metrics Server failed: %v", err)
+	// Admin routes share the metrics mux unless a separate admin port is set
+	metricsMux := metrics.MetricsHandler(config.AppConfig.MetricsPath)
+	adminMux := metricsMux
+	if config.AppConfig.AdminPort != "" && !config.AppConfig.MetricsOnAdminPort {
+		adminMux = http.NewServeMux()
+	}
+	// Probes for orchestrators: /readyz needs a healthy endpoint on every chain
+	adminMux.Handle("GET /healthz", gateway.LivenessHandler())
+	adminMux.Handle("GET /readyz", gateway.ReadinessHandler(gateways))
+	// The routes of each chain are served under /chains/<name>
+	for name, gw := range gateways {
+		prefix := ""
+		if name != "" {
+			prefix = "/chains/" + name
 		}
-	}()
+		adminMux.Handle(prefix+"/endpoints", http.StripPrefix(prefix, gw.EndpointsHandler()))
+		adminMux.Handle(prefix+"/admin/", http.StripPrefix(prefix, gw.AdminHandler()))
+	}
+	if config.AppConfig.EnablePprof {
+		log.Println("⚠️ pprof profiling is enabled under /debug/pprof/ on the admin routes")
+		adminMux.Handle("/debug/pprof/", gateway.PprofHandler(config.AppConfig.AdminToken))
+	}
+	if config.AppConfig.AdminPort != "" {
+		log.Printf("🛠️ Admin listening on http://localhost%s", config.AppConfig.AdminPort)
+		listeners["admin"], auxServers = startAuxServer(ctx, "admin", config.AppConfig.AdminPort, adminMux, auxServers)
+	}
+	if config.AppConfig.MetricsOnAdminPort {
+		log.Printf("📊 Metrics listening on http://localhost%s%s", config.AppConfig.AdminPort, config.AppConfig.MetricsPath)
+	} else {
+		log.Printf("📊 Metrics listening on http://localhost%s%s", config.AppConfig.MetricsPort, config.AppConfig.MetricsPath)
+		listeners["metrics"], auxServers = startAuxServer(ctx, "metrics", config.AppConfig.MetricsPort, metricsMux, auxServers)
+	}
 
 	// Wait for shutdown signal
 	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	sig := <-quit
-	log.Printf("Received signal %v. Shutting down server...", sig)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	if config.AppConfig.GracefulRestart && listener.RestartSignal != nil {
+		signal.Notify(quit, listener.RestartSignal)
+	}
+	for {
+		sig := <-quit
+		if sig == syscall.SIGHUP {
+			// Apply endpoint changes and renewed certificates without restarting
+			log.Printf("Received signal %v. Reloading %s...", sig, configFilename)
+			if certs != nil {
+				if err := certs.Reload(); err != nil {
+					log.Printf("Certificate reload failed, keeping current certificate: %v", err)
+				} else {
+					log.Printf("🔐 TLS certificate reloaded from %s", config.AppConfig.TLSCertFile)
+				}
+			}
+			newCfg, err := config.ReloadConfig(configFilename)
+			if err != nil {
+				log.Printf("Configuration reload failed, keeping current configuration: %v", err)
+				metrics.ConfigReloadsTotal.WithLabelValues("failure").Inc()
+				continue
+			}
+			applyConfig(gateways, newCfg)
+			metrics.ConfigReloadsTotal.WithLabelValues("success").Inc()
+			metrics.ConfigLastReloadTimestamp.SetToCurrentTime()
+			continue
+		}
+		if !listener.IsRestartSignal(sig) {
+			log.Printf("Received signal %v. Shutting down server...", sig)
+			break
+		}
 
-	// Signal the checker goroutine to stop
-	cancel()
+		// Hand the sockets to a new process, then drain this one
+		log.Printf("Received signal %v. Starting a new process for graceful restart...", sig)
+		pid, err := listener.Restart(listeners)
+		if err != nil {
+			log.Printf("Graceful restart failed, keeping current process: %v", err)
+			continue
+		}
+		log.Printf("New process started (PID %d). Draining this one...", pid)
+		break
+	}
 
-	// Shutdown the server gracefully
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	// Shut down stage by stage within one overall deadline
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), config.AppConfig.Shutdown.Timeout)
 	defer shutdownCancel()
 
-	if err := server.Shutdown(shutdownCtx); err != nil {
-		log.Fatalf("Server shutdown failed: %v", err)
+	failed := false
+	for _, stage := range config.AppConfig.Shutdown.Order {
+		switch stage {
+		case config.ShutdownProxy:
+			log.Println("Draining in-flight requests...")
+			if err := server.Shutdown(shutdownCtx); err != nil {
+				log.Printf("Server shutdown failed: %v", err)
+				failed = true
+			}
+			// Hijacked WebSocket connections outlive server.Shutdown
+			for name, gw := range gateways {
+				if err := gw.Shutdown(shutdownCtx); err != nil {
+					log.Printf("%sGateway shutdown failed: %v", chainLabel(name), err)
+					failed = true
+				}
+			}
+		case config.ShutdownChecker:
+			for name, gw := range gateways {
+				if err := gw.StopChecker(shutdownCtx); err != nil {
+					log.Printf("%sChecker shutdown failed: %v", chainLabel(name), err)
+					failed = true
+				}
+			}
+			// Stops the agreement monitor too
+			cancel()
+		case config.ShutdownMetrics:
+			if grace := config.AppConfig.Shutdown.MetricsGrace; grace > 0 {
+				log.Printf("Keeping metrics up for %v for a final scrape...", grace)
+				select {
+				case <-time.After(grace):
+				case <-shutdownCtx.Done():
+				}
+			}
+			for _, aux := range auxServers {
+				if err := aux.Shutdown(shutdownCtx); err != nil {
+					log.Printf("Server on %s shutdown failed: %v", aux.Addr, err)
+					failed = true
+				}
+			}
+		}
+	}
+
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		log.Printf("Failed to flush traces: %v", err)
+	}
+	for name, gw := range gateways {
+		if err := gw.Close(); err != nil {
+			log.Printf("%sFailed to close gateway: %v", chainLabel(name), err)
+		}
+	}
+	if failed {
+		os.Exit(1)
 	}
 
 	log.Println("Server gracefully stopped.")
 }
+
+// newGateways creates the gateway of every chain, keyed by chain name, or a
+// single gateway keyed by an empty name without chains.
+func newGateways(cfg *config.Config) (map[string]*gateway.Gateway, error) {
+	if len(cfg.Chains) > 0 {
+		return gateway.NewGateways(cfg)
+	}
+	gw, err := gateway.NewGateway(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]*gateway.Gateway{"": gw}, nil
+}
+
+// chainLabel prefixes log messages about the gateway of the named chain, and
+// is empty for a single-chain gateway.
+func chainLabel(name string) string {
+	if name == "" {
+		return ""
+	}
+	return "Chain " + name + ": "
+}
+
+// applyConfig applies a reloaded configuration to the running gateways,
+// matching chains by name. Adding or removing chains, or switching between
+// chains and rpcEndpoints, takes a restart.
+func applyConfig(gateways map[string]*gateway.Gateway, cfg *config.Config) {
+	if len(cfg.Chains) == 0 {
+		if gw, ok := gateways[""]; ok {
+			gw.ApplyConfig(cfg)
+			return
+		}
+		log.Println("⚠️ Reloaded configuration has no chains. Restart to switch to rpcEndpoints; keeping the current chains.")
+		return
+	}
+	if _, ok := gateways[""]; ok {
+		log.Println("⚠️ Reloaded configuration has chains. Restart to switch to them; keeping the current endpoints.")
+		return
+	}
+	for _, chain := range cfg.Chains {
+		gw, ok := gateways[chain.Name]
+		if !ok {
+			log.Printf("⚠️ Chain %s is new and will be served after a restart.", chain.Name)
+			continue
+		}
+		gw.ApplyConfig(chain.Config)
+	}
+	for name := range gateways {
+		if !slices.ContainsFunc(cfg.Chains, func(chain config.ChainConfig) bool { return chain.Name == name }) {
+			log.Printf("⚠️ Chain %s was removed and keeps being served until a restart.", name)
+		}
+	}
+}
+
+// listenURL describes where a listener on addr is reached: a localhost URL
+// for a TCP port, or the socket path for a Unix domain socket.
+func listenURL(scheme, addr string) string {
+	if path, ok := listener.UnixSocketPath(addr); ok {
+		return scheme + " over unix socket " + path
+	}
+	return scheme + "://localhost" + addr
+}
+
+// startAuxServer opens a listener for an operational server (metrics, admin)
+// and serves handler on it in the background. It returns the listener, so it
+// can be handed over on a graceful restart, and servers with the new server
+// appended for shutdown.
+func startAuxServer(ctx context.Context, name, addr string, handler http.Handler, servers []*http.Server) (net.Listener, []*http.Server) {
+	ln, err := listener.Listen(ctx, name, addr, config.ListenerConfig{})
+	if err != nil {
+		log.Fatalf("Fatal: Failed to listen on %s: %v", addr, err)
+	}
+
+	server := &http.Server{
+		Addr:    addr,
+		Handler: handler,
+	}
+	go func() {
+		if err := server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Fatal: %s server failed: %v", name, err)
+		}
+	}()
+	return ln, append(servers, server)
+}
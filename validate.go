@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"rpc-load-balancer/internal/config"
+	"slices"
+	"text/tabwriter"
+	"time"
+)
+
+// validate loads the configuration, runs one health check against every
+// endpoint and prints the results, without serving. It returns the exit
+// code: 1 if the configuration is invalid, the endpoints of a chain disagree
+// on the chain ID, or a chain has no reachable endpoint.
+func validate() int {
+	if err := config.LoadConfig(configFilename); err != nil {
+		log.Printf("❌ Invalid configuration: %v", err)
+		return 1
+	}
+	gateways, err := newGateways(&config.AppConfig)
+	if err != nil {
+		log.Printf("❌ Failed to initialize gateway: %v", err)
+		return 1
+	}
+
+	names := make([]string, 0, len(gateways))
+	for name := range gateways {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	exitCode := 0
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "CHAIN\tENDPOINT\tSTATUS\tBLOCK\tLATENCY")
+	for _, name := range names {
+		gw := gateways[name]
+		column := name
+		if column == "" {
+			column = "-"
+		}
+		if err := gw.VerifyChainConsistency(); err != nil {
+			log.Printf("❌ %s%v", chainLabel(name), err)
+			exitCode = 1
+		}
+		reachable := 0
+		for _, report := range gw.CheckEndpoints(context.Background()) {
+			if report.Status == "ok" {
+				reachable++
+			}
+			fmt.Fprintf(table, "%s\t%s\t%s\t%d\t%v\n", column, report.URL, report.Status, report.BlockNumber, report.Latency.Round(time.Microsecond))
+		}
+		if reachable == 0 {
+			log.Printf("❌ %sNo endpoint is reachable", chainLabel(name))
+			exitCode = 1
+		}
+		gw.Close()
+	}
+	table.Flush()
+	if exitCode == 0 {
+		log.Println("✅ Configuration is valid")
+	}
+	return exitCode
+}